@@ -3,10 +3,10 @@ package main
 import (
 	"crypto/sha256"
 	"encoding/hex"
-	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
@@ -64,31 +64,36 @@ func handlerYourProblem(w *response.Writer, req *request.Request) {
 func writeHTMLResponse(w *response.Writer, statusCode response.StatusCode, html string) {
 	err := w.WriteStatusLine(statusCode)
 	if err != nil {
-		log.Fatalf("Error writing response status-line: %v", err)
+		slog.Error("Error writing response status-line", "error", err)
 		return
 	}
 
 	headers := response.GetDefaultHeaders(len(html))
-	headers.SetWithOverride("Content-Type", "text/html")
+	headers.Set("Content-Type", "text/html")
 
 	err = w.WriteHeaders(headers, false)
 	if err != nil {
-		log.Fatalf("Error writing response headers: %v", err)
+		slog.Error("Error writing response headers", "error", err)
 		return
 	}
 
 	_, err = w.WriteBody([]byte(html))
 	if err != nil {
-		log.Fatalf("Error writing response body: %v", err)
+		slog.Error("Error writing response body", "error", err)
 		return
 	}
 }
 
 func handlerProxy(w *response.Writer, req *request.Request) {
-	proxyToTarget := strings.TrimPrefix(req.RequestLine.RequestTarget, "/httpbin")
-	proxyToUrl := "https://httpbin.org" + proxyToTarget
+	proxyTo := url.URL{
+		Scheme:   "https",
+		Host:     "httpbin.org",
+		Path:     "/" + req.PathParam("path"),
+		RawQuery: req.RawQuery(),
+	}
+	proxyToUrl := proxyTo.String()
 
-	fmt.Println(proxyToUrl)
+	slog.Debug("Proxying request", "url", proxyToUrl)
 
 	resp, err := http.Get(proxyToUrl)
 	if err != nil {
@@ -97,12 +102,10 @@ func handlerProxy(w *response.Writer, req *request.Request) {
 	}
 	defer resp.Body.Close()
 
-	respHeaders := headers.Headers{
-		"connection":        "close",
-		"content-type":      "text/plain",
-		"transfer-encoding": "chunked",
-		"trailer":           "X-Content-SHA256, X-Content-Length",
-	}
+	respHeaders := headers.NewHeaders()
+	respHeaders.Set("Content-Type", "text/plain")
+	respHeaders.Set("Transfer-Encoding", "chunked")
+	respHeaders.Set("Trailer", "X-Content-SHA256, X-Content-Length")
 
 	w.WriteStatusLine(response.StatusOK)
 	w.WriteHeaders(respHeaders, false)
@@ -141,10 +144,9 @@ func handlerProxy(w *response.Writer, req *request.Request) {
 	// Convert length to a string
 	bodyLengthStr := strconv.Itoa(len(body))
 
-	trailers := headers.Headers{
-		"x-content-sha256": bodyHashHex,
-		"x-content-length": bodyLengthStr,
-	}
+	trailers := headers.NewHeaders()
+	trailers.Set("X-Content-SHA256", bodyHashHex)
+	trailers.Set("X-Content-Length", bodyLengthStr)
 
 	w.WriteTrailers(trailers)
 }
@@ -153,13 +155,13 @@ func handlerProxy(w *response.Writer, req *request.Request) {
 func handlerGetVideo(w *response.Writer, req *request.Request) {
 	videoFileBytes, err := os.ReadFile("./assets/vim.mp4")
 	if err != nil {
-		log.Fatalf("Error reading video file: %v", err)
+		slog.Error("Error reading video file", "error", err)
 		return
 	}
 
 	err = w.WriteStatusLine(response.StatusOK)
 	if err != nil {
-		log.Fatalf("Error writing response status-line: %v", err)
+		slog.Error("Error writing response status-line", "error", err)
 		return
 	}
 
@@ -168,13 +170,13 @@ func handlerGetVideo(w *response.Writer, req *request.Request) {
 
 	err = w.WriteHeaders(headers, false)
 	if err != nil {
-		log.Fatalf("Error writing response headers: %v", err)
+		slog.Error("Error writing response headers", "error", err)
 		return
 	}
 
 	_, err = w.WriteBody(videoFileBytes)
 	if err != nil {
-		log.Fatalf("Error writing response body: %v", err)
+		slog.Error("Error writing response body", "error", err)
 		return
 	}
 }
@@ -183,7 +185,7 @@ func handlerGetVideo(w *response.Writer, req *request.Request) {
 func handlerGetVideoStream(w *response.Writer, req *request.Request) {
 	videoFile, err := os.Open("./assets/vim.mp4")
 	if err != nil {
-		log.Printf("Error opening video file: %v", err)
+		slog.Error("Error opening video file", "error", err)
 		w.WriteStatusLine(response.StatusInternalServerError)
 		return
 	}
@@ -191,7 +193,7 @@ func handlerGetVideoStream(w *response.Writer, req *request.Request) {
 
 	err = w.WriteStatusLine(response.StatusOK)
 	if err != nil {
-		log.Printf("Error writing response status-line: %v", err)
+		slog.Error("Error writing response status-line", "error", err)
 		return
 	}
 
@@ -200,7 +202,7 @@ func handlerGetVideoStream(w *response.Writer, req *request.Request) {
 
 	fileInfo, err := videoFile.Stat()
 	if err != nil {
-		log.Printf("Error getting file info: %v", err)
+		slog.Error("Error getting file info", "error", err)
 		w.WriteStatusLine(response.StatusInternalServerError)
 		return
 	}
@@ -209,7 +211,7 @@ func handlerGetVideoStream(w *response.Writer, req *request.Request) {
 
 	err = w.WriteHeaders(headers, false)
 	if err != nil {
-		log.Printf("Error writing response headers: %v", err)
+		slog.Error("Error writing response headers", "error", err)
 		return
 	}
 
@@ -218,9 +220,9 @@ func handlerGetVideoStream(w *response.Writer, req *request.Request) {
 	if err != nil {
 		// Detect "broken pipe" and avoid logging it as an error
 		if strings.Contains(err.Error(), "broken pipe") || strings.Contains(err.Error(), "reset by peer") {
-			log.Printf("Client disconnected before full response was sent")
+			slog.Info("Client disconnected before full response was sent")
 			return
 		}
-		log.Printf("Error writing response body: %v", err)
+		slog.Error("Error writing response body", "error", err)
 	}
 }
@@ -1,47 +1,53 @@
 package main
 
 import (
-	"log"
+	"context"
+	"log/slog"
 	"os"
 	"os/signal"
-	"strings"
 	"syscall"
+	"time"
 
-	"github.com/agustin-carnevale/tcp-to-http/internal/request"
-	"github.com/agustin-carnevale/tcp-to-http/internal/response"
+	"github.com/agustin-carnevale/tcp-to-http/internal/router"
 	"github.com/agustin-carnevale/tcp-to-http/internal/server"
 )
 
 const port = 42069
+const shutdownTimeout = 30 * time.Second
 
-func handler(w *response.Writer, req *request.Request) {
-	if strings.HasPrefix(req.RequestLine.RequestTarget, "/httpbin") {
-		handlerProxy(w, req)
-		return
-	} else if req.RequestLine.RequestTarget == "/yourproblem" {
-		handlerYourProblem(w, req)
-		return
-	} else if req.RequestLine.RequestTarget == "/myproblem" {
-		handlerMyProblem(w, req)
-		return
-	} else if req.RequestLine.RequestTarget == "/video" {
-		handlerGetVideoStream(w, req)
-		return
-	}
-
-	handlerStatusOk(w, req)
+func newRouter() *router.Router {
+	r := router.New()
+	r.Get("/", handlerStatusOk)
+	r.Get("/httpbin/*path", handlerProxy)
+	r.Get("/yourproblem", handlerYourProblem)
+	r.Get("/myproblem", handlerMyProblem)
+	r.Get("/video", handlerGetVideoStream)
+	return r
 }
 
 func main() {
-	server, err := server.Serve(port, handler)
+	server, err := server.ServeWithConfig(port, newRouter().Serve, server.Config{
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       60 * time.Second,
+		AccessLog:         os.Stdout,
+	})
 	if err != nil {
-		log.Fatalf("Error starting server: %v", err)
+		slog.Error("Error starting server", "error", err)
+		os.Exit(1)
 	}
-	defer server.Close()
-	log.Println("Server started on port", port)
+	slog.Info("Server started", "port", port)
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	<-sigChan
-	log.Println("Server gracefully stopped")
+
+	// let in-flight responses finish before exiting
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	cut, err := server.Shutdown(ctx)
+	if err != nil {
+		slog.Warn("Server stopped", "connections_cut", cut, "error", err)
+		return
+	}
+	slog.Info("Server gracefully stopped")
 }
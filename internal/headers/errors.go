@@ -0,0 +1,12 @@
+package headers
+
+import "errors"
+
+// Errors returned by Parse, usable with errors.Is
+var (
+	ErrMalformedHeaderLine = errors.New("invalid header format")
+	ErrSpaceBeforeColon    = errors.New("invalid header format (space between key and :)")
+	ErrInvalidHeaderName   = errors.New("invalid header key")
+	ErrInvalidHeaderValue  = errors.New("invalid header value")
+	ErrObsFold             = errors.New("obsolete line folding not allowed")
+)
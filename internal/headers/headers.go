@@ -2,12 +2,23 @@ package headers
 
 import (
 	"bytes"
-	"errors"
+	"fmt"
+	"iter"
+	"slices"
 	"strings"
-	"unicode"
 )
 
-type Headers map[string]string
+// Headers are the fields of a message (or its trailers). Fields keep the
+// order they were added in and the casing of their name as first added,
+// and a field sent more than once keeps each of its values.
+type Headers struct {
+	fields []field
+}
+
+type field struct {
+	name   string
+	values []string
+}
 
 const CRLF = "\r\n"
 
@@ -17,38 +28,139 @@ var allowedKeySpecialChars = map[rune]struct{}{
 	'^': {}, '_': {}, '`': {}, '|': {}, '~': {},
 }
 
-func NewHeaders() Headers {
-	return map[string]string{}
+func NewHeaders() *Headers {
+	return &Headers{}
+}
+
+// isSetCookie reports whether key is Set-Cookie, the one field whose values
+// can't be combined into a comma-separated list (a cookie can contain commas)
+func isSetCookie(key string) bool {
+	return strings.EqualFold(key, "Set-Cookie")
+}
+
+// index returns the position of the field named key (case-insensitive), or -1
+func (h *Headers) index(key string) int {
+	if h == nil {
+		return -1
+	}
+	for i, f := range h.fields {
+		if strings.EqualFold(f.name, key) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Get returns the value of the field named key, with repeated values combined
+// into a comma-separated list. For Set-Cookie only the first value is returned,
+// use Values to get all of them.
+func (h *Headers) Get(key string) (string, bool) {
+	i := h.index(key)
+	if i == -1 {
+		return "", false
+	}
+
+	values := h.fields[i].values
+	if isSetCookie(key) {
+		return values[0], true
+	}
+	return strings.Join(values, ", "), true
+}
+
+// Values returns every value of the field named key, in the order they were added
+func (h *Headers) Values(key string) []string {
+	i := h.index(key)
+	if i == -1 {
+		return nil
+	}
+	return slices.Clone(h.fields[i].values)
 }
 
-func (h Headers) Get(key string) (string, bool) {
-	key = strings.ToLower(key)
-	value, exists := h[key]
+// Add adds value to the field named key, after the values it already has
+func (h *Headers) Add(key, value string) {
+	if i := h.index(key); i != -1 {
+		h.fields[i].values = append(h.fields[i].values, value)
+		return
+	}
+	h.fields = append(h.fields, field{name: key, values: []string{value}})
+}
 
-	return value, exists
+// Set replaces the values of the field named key with value,
+// the field keeps its position if it already exists
+func (h *Headers) Set(key, value string) {
+	if i := h.index(key); i != -1 {
+		h.fields[i].values = []string{value}
+		return
+	}
+	h.fields = append(h.fields, field{name: key, values: []string{value}})
 }
 
-func (h Headers) Set(key, value string) {
-	// make key lowercase
-	key = strings.ToLower(key)
+// Del removes the field named key
+func (h *Headers) Del(key string) {
+	if i := h.index(key); i != -1 {
+		h.fields = slices.Delete(h.fields, i, i+1)
+	}
+}
+
+// Len returns the number of fields (a repeated field counts once)
+func (h *Headers) Len() int {
+	if h == nil {
+		return 0
+	}
+	return len(h.fields)
+}
+
+// All iterates over the field lines to send, in order: one line per field
+// with its values combined, except for Set-Cookie, sent once per value
+func (h *Headers) All() iter.Seq2[string, string] {
+	return func(yield func(string, string) bool) {
+		if h == nil {
+			return
+		}
+		for _, f := range h.fields {
+			if isSetCookie(f.name) {
+				for _, value := range f.values {
+					if !yield(f.name, value) {
+						return
+					}
+				}
+				continue
+			}
+			if !yield(f.name, strings.Join(f.values, ", ")) {
+				return
+			}
+		}
+	}
+}
 
-	// if header already exists append new value (comma-separated)
-	currentValue, exists := h[key]
-	if exists {
-		h[key] = currentValue + ", " + value
-	} else {
-		h[key] = value
+// Clone returns a copy of h that can be changed without changing h
+func (h *Headers) Clone() *Headers {
+	clone := NewHeaders()
+	if h == nil {
+		return clone
+	}
+	for _, f := range h.fields {
+		clone.fields = append(clone.fields, field{name: f.name, values: slices.Clone(f.values)})
 	}
+	return clone
 }
 
-func (h Headers) SetWithOverride(key, value string) {
-	// make key lowercase
-	key = strings.ToLower(key)
-	h[key] = value
+// Parse parses one field line (key: value \r\n), or the empty line ending
+// the fields. Lines starting with whitespace (obs-fold, the obsolete line
+// folding of RFC 9112) are rejected, see ParseLenient.
+func (h *Headers) Parse(data []byte) (n int, done bool, err error) {
+	return h.parse(data, false)
 }
 
-// key: value \r\n
-func (h Headers) Parse(data []byte) (n int, done bool, err error) {
+// ParseLenient parses one field line like Parse, but a line starting with
+// whitespace continues the previous field value (obs-fold), as it did for
+// older clients. The fold is replaced by a single space. A first line
+// starting with whitespace is still rejected.
+func (h *Headers) ParseLenient(data []byte) (n int, done bool, err error) {
+	return h.parse(data, true)
+}
+
+func (h *Headers) parse(data []byte, unfold bool) (n int, done bool, err error) {
 	endOfHeaderIdx := bytes.Index(data, []byte(CRLF))
 
 	// More data needed
@@ -60,22 +172,38 @@ func (h Headers) Parse(data []byte) (n int, done bool, err error) {
 		return 2, true, nil
 	}
 
+	line := string(data[:endOfHeaderIdx])
+	bytesConsumed := endOfHeaderIdx + len(CRLF)
+
+	if line[0] == ' ' || line[0] == '\t' {
+		if !unfold {
+			return 0, false, ErrObsFold
+		}
+		if h.Len() == 0 {
+			// nothing to continue: whitespace before the first field could
+			// hide a field from another parser (RFC 9112 section 2.2)
+			return 0, false, ErrObsFold
+		}
+		// continuation of the last value received
+		value := strings.Trim(line, " \t")
+		if !ValidFieldValue(value) {
+			return 0, false, fmt.Errorf("%w: %q", ErrInvalidHeaderValue, value)
+		}
+		if value != "" {
+			last := &h.fields[len(h.fields)-1]
+			last.values[len(last.values)-1] += " " + value
+		}
+		return bytesConsumed, false, nil
+	}
+
 	// parse header
-	key, value, err := parseHeader(string(data[:endOfHeaderIdx]))
+	key, value, err := parseHeader(line)
 	if err != nil {
 		return 0, false, err
 	}
 
 	// store header
-	h.Set(key, value)
-
-	bytesConsumed := endOfHeaderIdx + len(CRLF)
-
-	// Contemplate edge case is last header (and there is no body)
-	CRLFIdx := bytes.Index(data[bytesConsumed:], []byte(CRLF))
-	if CRLFIdx == 0 {
-		return bytesConsumed, true, nil
-	}
+	h.Add(key, value)
 
 	return bytesConsumed, false, nil
 }
@@ -84,38 +212,66 @@ func parseHeader(header string) (key string, value string, err error) {
 	key, value, found := strings.Cut(header, ":")
 
 	if !found {
-		return "", "", errors.New("invalid header format")
+		return "", "", ErrMalformedHeaderLine
 	}
 
 	// Header key
-	// Trim whitespace at the beginig
-	key = strings.TrimLeft(key, " ")
-
 	// Check there is no space the end
 	// between key and : (this "key  : value" is not valid)
-	if key != strings.TrimSpace(key) {
-		return "", "", errors.New("invalid header format (space between key and :)")
+	if key != strings.TrimRight(key, " \t") {
+		return "", "", ErrSpaceBeforeColon
 	}
 
-	if !validHeaderKeyChars(key) {
-		return "", "", errors.New("invalid header key")
+	if !ValidFieldName(key) {
+		return "", "", fmt.Errorf("%w: %q", ErrInvalidHeaderName, key)
 	}
 
 	//Header Value
-	value = strings.TrimSpace(value)
+	// only spaces and tabs are optional whitespace around the value
+	value = strings.Trim(value, " \t")
+	if !ValidFieldValue(value) {
+		return "", "", fmt.Errorf("%w: %q", ErrInvalidHeaderValue, value)
+	}
 
 	return key, value, nil
 }
 
-func validHeaderKeyChars(key string) bool {
-	if len(key) == 0 {
+// ValidFieldName reports whether name is a valid field name (a token)
+func ValidFieldName(name string) bool {
+	return IsToken(name)
+}
+
+// IsToken reports whether s is a token (RFC 9110 section 5.6.2): ASCII
+// letters, digits and a few special characters, used for field names,
+// methods...
+func IsToken(s string) bool {
+	if len(s) == 0 {
 		return false
 	}
-	for _, r := range key {
-		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
-			if _, exists := allowedKeySpecialChars[r]; !exists {
-				return false
-			}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') {
+			continue
+		}
+		if _, exists := allowedKeySpecialChars[rune(c)]; !exists {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidFieldValue reports whether value can be sent as a field value: visible
+// characters, spaces and tabs, and bytes over 0x7F (obs-text). Control
+// characters like CR, LF or NUL are never valid, they could be used to
+// inject fields or split a message.
+func ValidFieldValue(value string) bool {
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c == '\t' {
+			continue
+		}
+		if c < ' ' || c == 0x7f {
+			return false
 		}
 	}
 	return true
@@ -10,37 +10,46 @@ import (
 func TestRequestHeaders(t *testing.T) {
 
 	// Test: Valid single header
-	headers := Headers{}
+	headers := NewHeaders()
 	data := []byte("Host: localhost:42069\r\n\r\n")
 	n, done, err := headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "localhost:42069", headers["host"])
+	assert.Equal(t, []string{"localhost:42069"}, headers.Values("host"))
 	assert.Equal(t, 23, n)
 	assert.False(t, done)
 
 	// Test: Valid single header with extra whitespace
-	headers = Headers{}
-	data = []byte("    Host:    localhost:42069     \r\n\r\n")
+	headers = NewHeaders()
+	data = []byte("Host:    localhost:42069     \r\n\r\n")
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "localhost:42069", headers["host"])
-	assert.Equal(t, 35, n)
+	assert.Equal(t, []string{"localhost:42069"}, headers.Values("host"))
+	assert.Equal(t, 31, n)
 	assert.False(t, done)
 
+	// Test: Leading whitespace before the first field, rejected even by ParseLenient
+	headers = NewHeaders()
+	data = []byte("    Host:    localhost:42069     \r\n\r\n")
+	_, _, err = headers.Parse(data)
+	assert.ErrorIs(t, err, ErrObsFold)
+	_, _, err = headers.ParseLenient(data)
+	assert.ErrorIs(t, err, ErrObsFold)
+	assert.Equal(t, 0, headers.Len())
+
 	// Test: Valid 2 headers
-	headers = Headers{}
+	headers = NewHeaders()
 	data = []byte("Host: localhost:42069\r\n Content-Type: application/json \r\n\r\n")
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "localhost:42069", headers["host"])
+	assert.Equal(t, []string{"localhost:42069"}, headers.Values("host"))
 	assert.Equal(t, 23, n)
 	assert.False(t, done)
 
 	// Test: Valid Done
-	headers = Headers{}
+	headers = NewHeaders()
 	data = []byte("\r\n")
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
@@ -48,7 +57,7 @@ func TestRequestHeaders(t *testing.T) {
 	assert.Equal(t, 2, n)
 
 	// Test: Invalid spacing header
-	headers = Headers{}
+	headers = NewHeaders()
 	data = []byte("       Host : localhost:42069       \r\n\r\n")
 	n, done, err = headers.Parse(data)
 	require.Error(t, err)
@@ -56,17 +65,17 @@ func TestRequestHeaders(t *testing.T) {
 	assert.False(t, done)
 
 	// Test: Valid header key with digits and special character
-	headers = Headers{}
+	headers = NewHeaders()
 	data = []byte("Host_!19:    localhost:42069     \r\n\r\n")
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "localhost:42069", headers["host_!19"])
+	assert.Equal(t, []string{"localhost:42069"}, headers.Values("host_!19"))
 	assert.Equal(t, 35, n)
 	assert.False(t, done)
 
 	// Test: Invalid special characters on header key
-	headers = Headers{}
+	headers = NewHeaders()
 	data = []byte("H©st@: localhost:42069       \r\n\r\n")
 	n, done, err = headers.Parse(data)
 	require.Error(t, err)
@@ -74,11 +83,120 @@ func TestRequestHeaders(t *testing.T) {
 	assert.False(t, done)
 
 	// Test: Valiud multiple same key headers
-	headers = Headers{}
-	headers["set-developer"] = "Agustin"
+	headers = NewHeaders()
+	headers.Add("Set-Developer", "Agustin")
 	data = []byte("Set-Developer: Michael \r\n\r\n")
 	_, _, err = headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "Agustin, Michael", headers["set-developer"])
+	value, _ := headers.Get("set-developer")
+	assert.Equal(t, "Agustin, Michael", value)
+}
+
+func TestRequestHeadersErrors(t *testing.T) {
+	// Test: Missing colon
+	headers := NewHeaders()
+	_, _, err := headers.Parse([]byte("Host localhost\r\n\r\n"))
+	assert.ErrorIs(t, err, ErrMalformedHeaderLine)
+
+	// Test: Space before colon
+	_, _, err = headers.Parse([]byte("Host : localhost:42069\r\n\r\n"))
+	assert.ErrorIs(t, err, ErrSpaceBeforeColon)
+
+	// Test: Invalid header name
+	_, _, err = headers.Parse([]byte("H©st: localhost:42069\r\n\r\n"))
+	assert.ErrorIs(t, err, ErrInvalidHeaderName)
+	_, _, err = headers.Parse([]byte("Hést: localhost:42069\r\n\r\n"))
+	assert.ErrorIs(t, err, ErrInvalidHeaderName)
+
+	// Test: Control characters in the value
+	for _, line := range []string{
+		"X-Injected: a\rSet-Cookie: b=2\r\n",
+		"X-Injected: a\nSet-Cookie: b=2\r\n",
+		"X-Nul: a\x00b\r\n",
+		"X-Del: a\x7fb\r\n",
+	} {
+		_, _, err = headers.Parse([]byte(line))
+		assert.ErrorIs(t, err, ErrInvalidHeaderValue, line)
+	}
+
+	// Test: Obsolete line folding
+	headers = NewHeaders()
+	_, _, err = headers.Parse([]byte("X-Folded: first\r\n"))
+	require.NoError(t, err)
+	_, _, err = headers.Parse([]byte(" second\r\n"))
+	assert.ErrorIs(t, err, ErrObsFold)
+	_, _, err = headers.Parse([]byte("\tsecond\r\n"))
+	assert.ErrorIs(t, err, ErrObsFold)
+	assert.Equal(t, []string{"first"}, headers.Values("X-Folded"))
+}
+
+func TestRequestHeadersLenient(t *testing.T) {
+	// Test: Folded value joined with a single space
+	headers := NewHeaders()
+	data := []byte("X-Folded: first\r\n  \t second  \r\n\tthird\r\nHost: localhost\r\n\r\n")
+	for {
+		n, done, err := headers.ParseLenient(data)
+		require.NoError(t, err)
+		require.NotZero(t, n)
+		data = data[n:]
+		if done {
+			break
+		}
+	}
+	assert.Equal(t, []string{"first second third"}, headers.Values("X-Folded"))
+	assert.Equal(t, []string{"localhost"}, headers.Values("Host"))
+
+	// Test: Folded lines are still validated
+	_, _, err := headers.ParseLenient([]byte(" bad\x00value\r\n"))
+	assert.ErrorIs(t, err, ErrInvalidHeaderValue)
+}
+
+func TestHeaders(t *testing.T) {
+	// Test: Original casing and order are kept
+	h := NewHeaders()
+	h.Set("Content-Type", "text/plain")
+	h.Add("X-Request-ID", "abc")
+	h.Set("content-type", "text/html")
+	value, exists := h.Get("CONTENT-TYPE")
+	assert.True(t, exists)
+	assert.Equal(t, "text/html", value)
+	lines := []string{}
+	for key, value := range h.All() {
+		lines = append(lines, key+": "+value)
+	}
+	assert.Equal(t, []string{"Content-Type: text/html", "X-Request-ID: abc"}, lines)
+
+	// Test: Multiple values
+	h.Add("Accept", "text/html")
+	h.Add("accept", "application/json")
+	assert.Equal(t, []string{"text/html", "application/json"}, h.Values("Accept"))
+	value, _ = h.Get("Accept")
+	assert.Equal(t, "text/html, application/json", value)
+
+	// Test: Set-Cookie values are never combined
+	h = NewHeaders()
+	h.Add("Set-Cookie", "a=1; Expires=Wed, 21 Oct 2026 07:28:00 GMT")
+	h.Add("Set-Cookie", "b=2")
+	value, _ = h.Get("set-cookie")
+	assert.Equal(t, "a=1; Expires=Wed, 21 Oct 2026 07:28:00 GMT", value)
+	lines = []string{}
+	for key, value := range h.All() {
+		lines = append(lines, key+": "+value)
+	}
+	assert.Equal(t, []string{"Set-Cookie: a=1; Expires=Wed, 21 Oct 2026 07:28:00 GMT", "Set-Cookie: b=2"}, lines)
+
+	// Test: Delete and clone
+	clone := h.Clone()
+	h.Del("SET-COOKIE")
+	_, exists = h.Get("Set-Cookie")
+	assert.False(t, exists)
+	assert.Equal(t, 0, h.Len())
+	assert.Len(t, clone.Values("Set-Cookie"), 2)
+
+	// Test: Nil headers are empty
+	var empty *Headers
+	_, exists = empty.Get("Host")
+	assert.False(t, exists)
+	assert.Equal(t, 0, empty.Len())
 }
@@ -0,0 +1,126 @@
+package request
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/agustin-carnevale/tcp-to-http/internal/headers"
+)
+
+// chunk sizes bigger than this are rejected,
+// so the hex parsing can never overflow an int
+const maxChunkSizeDigits = 15
+
+// longest chunk-size line accepted (size and extensions), so a client
+// can't make the buffer grow forever by never ending the line
+const maxChunkLineBytes = 4096
+
+// isChunked reports whether the body is sent with chunked Transfer-Encoding.
+// Chunked must be the last (and here the only supported) coding, and a request
+// can't declare both Transfer-Encoding and Content-Length (request smuggling).
+func isChunked(h *headers.Headers) (bool, error) {
+	transferEncoding, exists := h.Get("Transfer-Encoding")
+	if !exists {
+		return false, nil
+	}
+
+	if _, exists := h.Get("Content-Length"); exists {
+		return false, fmt.Errorf("%w: not allowed with Transfer-Encoding", ErrInvalidContentLength)
+	}
+
+	if !strings.EqualFold(strings.TrimSpace(transferEncoding), "chunked") {
+		return false, fmt.Errorf("%w: %s", ErrUnsupportedTransferEncoding, transferEncoding)
+	}
+
+	return true, nil
+}
+
+// parseChunkSize parses a chunk-size line (chunk-size [ chunk-ext ] CRLF).
+// Chunk extensions are allowed but ignored.
+// It returns 0 bytes parsed if the line is not complete yet.
+func parseChunkSize(data []byte) (int, int, error) {
+	endOfLineIdx := bytes.Index(data, []byte(CRLF))
+	if endOfLineIdx == -1 {
+		if len(data) > maxChunkLineBytes {
+			return 0, 0, fmt.Errorf("%w: chunk-size line too long", ErrInvalidChunk)
+		}
+		return 0, 0, nil
+	}
+	if endOfLineIdx > maxChunkLineBytes {
+		return 0, 0, fmt.Errorf("%w: chunk-size line too long", ErrInvalidChunk)
+	}
+
+	line := string(data[:endOfLineIdx])
+
+	// chunk-ext = *( BWS ";" BWS chunk-ext-name [ BWS "=" BWS chunk-ext-val ] )
+	sizeString, _, _ := strings.Cut(line, ";")
+	sizeString = strings.TrimRight(sizeString, " \t")
+
+	if len(sizeString) == 0 || len(sizeString) > maxChunkSizeDigits {
+		return 0, 0, fmt.Errorf("%w: invalid size %q", ErrInvalidChunk, sizeString)
+	}
+	for _, c := range sizeString {
+		if !isHexDigit(c) {
+			return 0, 0, fmt.Errorf("%w: invalid size %q", ErrInvalidChunk, sizeString)
+		}
+	}
+
+	chunkSize, err := strconv.ParseInt(sizeString, 16, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: invalid size %q", ErrInvalidChunk, sizeString)
+	}
+
+	return int(chunkSize), endOfLineIdx + len(CRLF), nil
+}
+
+func isHexDigit(c rune) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+// Fields that can't be sent as trailers, because they are needed
+// to frame or route the message, or to process the rest of it
+var forbiddenTrailers = map[string]struct{}{
+	"content-length":    {},
+	"transfer-encoding": {},
+	"trailer":           {},
+	"host":              {},
+	"content-type":      {},
+	"content-encoding":  {},
+	"content-range":     {},
+	"authorization":     {},
+	"cache-control":     {},
+	"expect":            {},
+	"te":                {},
+}
+
+// validateTrailers checks that every trailer field received
+// was announced by the client in the Trailer header (e.g. "Trailer: X-Content-SHA256")
+func validateTrailers(h *headers.Headers, trailers *headers.Headers) error {
+	if trailers.Len() == 0 {
+		return nil
+	}
+
+	declared := map[string]struct{}{}
+	if trailerHeader, exists := h.Get("Trailer"); exists {
+		for _, name := range strings.Split(trailerHeader, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name != "" {
+				declared[name] = struct{}{}
+			}
+		}
+	}
+
+	for key := range trailers.All() {
+		key = strings.ToLower(key)
+		if _, forbidden := forbiddenTrailers[key]; forbidden {
+			return fmt.Errorf("%w: field not allowed: %s", ErrInvalidTrailer, key)
+		}
+		if _, ok := declared[key]; !ok {
+			return fmt.Errorf("%w: field not declared in Trailer header: %s", ErrInvalidTrailer, key)
+		}
+	}
+
+	return nil
+}
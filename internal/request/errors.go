@@ -0,0 +1,60 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned by the parser, so callers can tell (with errors.Is)
+// what was wrong with a request and answer with the right status code.
+// Most of them are wrapped with more details about the failure.
+var (
+	ErrMalformedRequestLine        = errors.New("malformed request-line")
+	ErrInvalidMethod               = errors.New("invalid request method")
+	ErrInvalidTarget               = errors.New("invalid request target")
+	ErrUnsupportedVersion          = errors.New("unsupported http version")
+	ErrMalformedHeader             = errors.New("malformed header")
+	ErrInvalidContentLength        = errors.New("invalid Content-Length")
+	ErrUnsupportedTransferEncoding = errors.New("unsupported Transfer-Encoding")
+	ErrInvalidChunk                = errors.New("invalid chunk")
+	ErrInvalidTrailer              = errors.New("invalid trailer")
+	ErrBodyTooShort                = errors.New("body is shorter than Content-Length")
+	ErrBodyTooLong                 = errors.New("body is longer than Content-Length")
+	ErrUnexpectedData              = errors.New("unexpected data after end of request")
+	ErrInvalidHost                 = errors.New("invalid Host header")
+
+	// Errors returned when a request goes over one of its Limits
+	ErrRequestLineTooLong   = errors.New("request-line too long")
+	ErrHeaderFieldsTooLarge = errors.New("request header fields too large")
+	ErrBodyTooLarge         = errors.New("request body too large")
+)
+
+// ParseError is returned when the parser fails. It tells where in the
+// request the failure happened, the underlying error (one of the above,
+// possibly wrapping an error of the headers package) is available
+// through errors.Is / errors.As.
+type ParseError struct {
+	// Offset is the position (in bytes from the start of the request)
+	// of the element that couldn't be parsed
+	Offset int
+	// State is the parser state at that moment, e.g. "REQUEST_PARSING_HEADERS"
+	State string
+	Err   error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("parse error at byte %d (%s): %v", e.Offset, e.State, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// newParseError wraps err with the current position of the parser
+func (r *Request) newParseError(offset int, err error) *ParseError {
+	return &ParseError{
+		Offset: offset,
+		State:  r.state.String(),
+		Err:    err,
+	}
+}
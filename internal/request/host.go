@@ -0,0 +1,39 @@
+package request
+
+import "fmt"
+
+// Host returns the host (and port, if any) the request is for: the authority
+// of an absolute or authority-form target, which takes precedence over the
+// Host header, or else the (first) Host header value
+func (r *Request) Host() string {
+	target := r.RequestLine.Target
+	if target.Form == ABSOLUTE_FORM || target.Form == AUTHORITY_FORM {
+		return target.Authority
+	}
+	if values := r.Headers.Values("Host"); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// CheckHost checks the Host header of the request, which servers must
+// answer with a 400 if it's not right: HTTP/1.1 requests need exactly one
+// (HTTP/1.0 ones at most one), with a host[:port] value. An empty value
+// is allowed, for targets without a host.
+func (r *Request) CheckHost() error {
+	values := r.Headers.Values("Host")
+	switch {
+	case len(values) > 1:
+		return fmt.Errorf("%w: %d Host fields", ErrInvalidHost, len(values))
+	case len(values) == 0:
+		if r.RequestLine.HttpVersion == "1.0" {
+			return nil
+		}
+		return fmt.Errorf("%w: missing", ErrInvalidHost)
+	}
+
+	if values[0] != "" && !validAuthority(values[0], false) {
+		return fmt.Errorf("%w: %q", ErrInvalidHost, values[0])
+	}
+	return nil
+}
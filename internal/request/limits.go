@@ -0,0 +1,48 @@
+package request
+
+const (
+	DefaultMaxRequestLineBytes = 8 * 1024
+	DefaultMaxHeaderBytes      = 1 << 20 // 1 MB
+	DefaultMaxHeaderCount      = 100
+)
+
+// Limits bounds how much of a request the parser accepts,
+// so a client can't make the server grow its buffers indefinitely.
+// Zero values use the defaults above, except MaxBodyBytes where
+// zero means no limit (big bodies can be streamed).
+type Limits struct {
+	// MaxRequestLineBytes is the max length of the request-line (without CRLF)
+	MaxRequestLineBytes int
+	// MaxHeaderBytes is the max size of the header section (and of the trailers)
+	MaxHeaderBytes int
+	// MaxHeaderCount is the max number of header fields (and of trailer fields)
+	MaxHeaderCount int
+	// MaxBodyBytes is the max size of the (decoded) body
+	MaxBodyBytes int
+}
+
+func (l Limits) maxRequestLineBytes() int {
+	if l.MaxRequestLineBytes > 0 {
+		return l.MaxRequestLineBytes
+	}
+	return DefaultMaxRequestLineBytes
+}
+
+func (l Limits) maxHeaderBytes() int {
+	if l.MaxHeaderBytes > 0 {
+		return l.MaxHeaderBytes
+	}
+	return DefaultMaxHeaderBytes
+}
+
+func (l Limits) maxHeaderCount() int {
+	if l.MaxHeaderCount > 0 {
+		return l.MaxHeaderCount
+	}
+	return DefaultMaxHeaderCount
+}
+
+// bodyTooLarge reports whether a body of the given size goes over MaxBodyBytes
+func (l Limits) bodyTooLarge(size int) bool {
+	return l.MaxBodyBytes > 0 && size > l.MaxBodyBytes
+}
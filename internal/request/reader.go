@@ -0,0 +1,322 @@
+package request
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+
+	"github.com/agustin-carnevale/tcp-to-http/internal/headers"
+)
+
+// Reader reads successive requests from the same connection.
+// Bytes received after the end of a request are kept in its buffer
+// and used as the beginning of the next one, so pipelined requests
+// (sent back-to-back without waiting for responses) are not lost.
+type Reader struct {
+	reader      io.Reader
+	buffer      []byte
+	readToIndex int
+	limits      Limits
+	logger      *slog.Logger
+	// unfold obs-fold lines instead of rejecting the request
+	lenientHeaders bool
+	strictPaths    bool
+}
+
+func NewReader(reader io.Reader) *Reader {
+	return NewReaderWithLimits(reader, Limits{})
+}
+
+func NewReaderWithLimits(reader io.Reader, limits Limits) *Reader {
+	return &Reader{
+		reader: reader,
+		buffer: make([]byte, INITIAL_BUFFER_SIZE),
+		limits: limits,
+		logger: discardLogger,
+	}
+}
+
+// Nothing is logged unless a logger is given with SetLogger
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// SetLogger sets the logger used to report parse failures (at debug level),
+// usually with attributes identifying the connection
+func (r *Reader) SetLogger(logger *slog.Logger) {
+	if logger == nil {
+		logger = discardLogger
+	}
+	r.logger = logger
+}
+
+// SetLenientHeaders makes the reader accept header (and trailer) lines
+// continued with obsolete line folding, which are rejected by default.
+// See headers.ParseLenient.
+func (r *Reader) SetLenientHeaders(lenient bool) {
+	r.lenientHeaders = lenient
+}
+
+// SetStrictPaths makes the reader reject paths with encoded dot segments or
+// slashes (like "%2e%2e" or "%2f"), which are decoded and cleaned by default.
+// See Request.Path.
+func (r *Reader) SetStrictPaths(strict bool) {
+	r.strictPaths = strict
+}
+
+func (r *Reader) newRequest() *Request {
+	return &Request{
+		state:          REQUEST_INITIALIZED,
+		Headers:        headers.NewHeaders(),
+		Trailers:       headers.NewHeaders(),
+		limits:         r.limits,
+		lenientHeaders: r.lenientHeaders,
+		strictPaths:    r.strictPaths,
+	}
+}
+
+// ReadRequest parses the next request from the connection, body included.
+// It returns io.EOF if the connection is closed before any byte of a new
+// request was received, so callers looping over a connection know when to stop.
+func (r *Reader) ReadRequest() (*Request, error) {
+	request := r.newRequest()
+
+	err := r.readUntil(request, request.isCompleted)
+	if err != nil {
+		return nil, err
+	}
+
+	request.BodyReader = io.NopCloser(bytes.NewReader(request.Body))
+	return request, nil
+}
+
+// ReadRequestStream parses the request-line and headers of the next request
+// and returns as soon as they are done, without waiting for the body.
+// Bodies with a Content-Length up to maxBufferedBody bytes are still read
+// into Body, bigger (or chunked) ones are left on the connection and can be
+// read through BodyReader, which must be read or closed before reading the
+// next request. It is ReadRequestHeaders followed by BufferBody.
+func (r *Reader) ReadRequestStream(maxBufferedBody int) (*Request, error) {
+	request, err := r.ReadRequestHeaders()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.BufferBody(request, maxBufferedBody); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// ReadRequestHeaders parses the request-line and headers of the next request
+// and returns as soon as they are done. The body is left on the connection
+// and can be read through BodyReader (or buffered with BufferBody).
+func (r *Reader) ReadRequestHeaders() (*Request, error) {
+	request := r.newRequest()
+	request.streamBody = true
+
+	err := r.readUntil(request, request.isHeadersDone)
+	if err != nil {
+		return nil, err
+	}
+
+	if request.state == REQUEST_COMPLETED {
+		// everything is already here, nothing to stream
+		request.streamBody = false
+		request.Body = request.pending
+		request.pending = nil
+		request.BodyReader = io.NopCloser(bytes.NewReader(request.Body))
+		return request, nil
+	}
+
+	request.BodyReader = &bodyReader{
+		reader:  r,
+		request: request,
+	}
+	return request, nil
+}
+
+// BufferBody reads the body of a request returned by ReadRequestHeaders into
+// Body if it has a Content-Length up to maxBufferedBody bytes, before anything
+// was read from BodyReader. Other bodies are left to be streamed. A client
+// sending an Expect header waits for the server before sending its body,
+// so that body is never read here either.
+func (r *Reader) BufferBody(request *Request, maxBufferedBody int) error {
+	if request.state != REQUEST_PARSING_BODY || !request.streamBody {
+		return nil
+	}
+
+	contentLength, err := contentLengthInt(request.Headers)
+	if err != nil {
+		return err
+	}
+	if _, expects := request.Headers.Get("Expect"); expects || contentLength > maxBufferedBody {
+		return nil
+	}
+
+	// small body, buffer it (with what was already received)
+	request.streamBody = false
+	request.Body = request.pending
+	request.pending = nil
+
+	if err := r.readUntil(request, request.isCompleted); err != nil {
+		return err
+	}
+	request.BodyReader = io.NopCloser(bytes.NewReader(request.Body))
+	return nil
+}
+
+// WaitForRequest blocks until the next request starts arriving, that is until
+// there is at least one byte in the buffer. It returns io.EOF if the connection
+// is closed before that. Useful to tell an idle connection from a slow request.
+func (r *Reader) WaitForRequest() error {
+	for r.readToIndex == 0 {
+		numBytesRead, err := r.reader.Read(r.buffer)
+		r.readToIndex += numBytesRead
+		if err != nil {
+			if numBytesRead > 0 {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// readUntil parses what is already buffered and keeps reading from the
+// connection until done reports true (or an error happens).
+func (r *Reader) readUntil(request *Request, done func() bool) error {
+	for {
+		// PARSE FROM THE BUFFER
+		// (it may already hold the whole request if it was pipelined)
+		numBytesParsed, err := request.parse(r.buffer[:r.readToIndex])
+		if err != nil {
+			r.logger.Debug("Error parsing request", "error", err, "buffered", r.readToIndex)
+			return err
+		}
+
+		// Shift remaining unparsed data to the beginning of the buffer
+		copy(r.buffer, r.buffer[numBytesParsed:r.readToIndex])
+		r.readToIndex -= numBytesParsed
+
+		if done() {
+			return nil
+		}
+
+		if r.readToIndex >= len(r.buffer) {
+			// if buffer is full duplicate size/capacity
+			newBuffer := make([]byte, len(r.buffer)*2)
+			copy(newBuffer, r.buffer)
+			r.buffer = newBuffer
+		}
+
+		// READ INTO BUFFER
+		numBytesRead, err := r.reader.Read(r.buffer[r.readToIndex:])
+
+		// update/advance "pointer" after reading n bytes
+		r.readToIndex += numBytesRead
+
+		if err != nil {
+			if err == io.EOF && numBytesRead > 0 {
+				// parse what we got, the next read will report EOF again
+				continue
+			}
+			if err == io.EOF {
+				if request.state == REQUEST_INITIALIZED && r.readToIndex == 0 {
+					// nothing was received at all, the peer just closed the connection
+					// (e.g. a keep-alive client that has no more requests to send)
+					return io.EOF
+				}
+				if request.state == REQUEST_PARSING_BODY {
+					// we finish reading the request but body < Content-Length
+					// in this case we decided to return an error
+					// (because no match between actual body and what the header says)
+					return request.newParseError(request.offset, ErrBodyTooShort)
+				}
+				// connection closed in the middle of the request
+				return io.ErrUnexpectedEOF
+			}
+			r.logger.Debug("Error reading request", "error", err, "state", request.state.String())
+			return err
+		}
+	}
+}
+
+// Up to this many unread body bytes are discarded when a streamed body
+// is closed, so the connection can be reused. Beyond that it is cheaper
+// to close the connection than to keep reading data nobody wants.
+const maxDrainBodySize = 256 * 1024
+
+// bodyReader streams the body of a request from the connection,
+// decoding it (Content-Length or chunked) with the same parser
+type bodyReader struct {
+	reader  *Reader
+	request *Request
+	err     error
+	closed  bool
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	if b.closed {
+		return 0, errors.New("read on closed body")
+	}
+
+	request := b.request
+	if len(request.pending) == 0 {
+		if request.state == REQUEST_COMPLETED {
+			return 0, io.EOF
+		}
+		if b.err != nil {
+			return 0, b.err
+		}
+
+		err := b.reader.readUntil(request, func() bool {
+			return len(request.pending) > 0 || request.state == REQUEST_COMPLETED
+		})
+		if err != nil {
+			b.err = err
+			return 0, err
+		}
+		if len(request.pending) == 0 {
+			return 0, io.EOF
+		}
+	}
+
+	n := copy(p, request.pending)
+	request.pending = request.pending[n:]
+	return n, nil
+}
+
+// Close discards the rest of the body so the next request can be read.
+// It returns an error if the body was too big to be drained (or broken),
+// in which case the connection can't be reused.
+func (b *bodyReader) Close() error {
+	if b.closed {
+		return b.err
+	}
+	b.closed = true
+
+	if b.err != nil {
+		return b.err
+	}
+
+	request := b.request
+	drained := 0
+	for request.state != REQUEST_COMPLETED {
+		drained += len(request.pending)
+		request.pending = nil
+		if drained > maxDrainBodySize {
+			b.err = errors.New("body too big to be drained")
+			return b.err
+		}
+
+		err := b.reader.readUntil(request, func() bool {
+			return len(request.pending) > 0 || request.state == REQUEST_COMPLETED
+		})
+		if err != nil {
+			b.err = err
+			return err
+		}
+	}
+	request.pending = nil
+
+	return nil
+}
@@ -4,20 +4,57 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/url"
+	"strings"
 
 	"github.com/agustin-carnevale/tcp-to-http/internal/headers"
 )
 
 type Request struct {
 	RequestLine RequestLine
-	Headers     headers.Headers
-	Body        []byte
-	state       requestState
+	Headers     *headers.Headers
+	// Body holds the whole body when the request was fully buffered,
+	// it is nil when the body is streamed through BodyReader
+	Body []byte
+	// BodyReader is always available to read the body,
+	// for streamed requests it pulls the data lazily from the connection
+	BodyReader io.ReadCloser
+	// PathParams are the values captured from the path by a router,
+	// e.g. {"id": "42"} for the pattern /users/{id}
+	PathParams map[string]string
+	// Trailers are the fields sent after a chunked body,
+	// only the ones announced in the Trailer header are accepted
+	Trailers *headers.Headers
+	state    requestState
+	limits   Limits
+	// accept obs-fold lines in headers and trailers
+	lenientHeaders bool
+	// reject encoded dot segments and slashes in the path
+	strictPaths bool
+	// decoded and cleaned path, parsed query (see Path and Query)
+	path  string
+	query url.Values
+	// bytes parsed so far, to report where parse errors happen
+	offset int
+	// size and number of header (or trailer) fields parsed so far
+	headerBytes int
+	headerCount int
+	// bytes of the current chunk still to be read (chunked bodies only)
+	chunkRemaining int
+	// decoded body bytes received so far
+	bodyLength int
+	// when streaming, decoded body bytes go to pending (waiting for
+	// BodyReader to consume them) instead of being accumulated in Body
+	streamBody bool
+	pending    []byte
 }
 
 type RequestLine struct {
-	HttpVersion   string
+	HttpVersion string
+	// RequestTarget is the request-target as received,
+	// Target has it split in its parts
 	RequestTarget string
+	Target        Target
 	Method        string
 }
 
@@ -27,76 +64,58 @@ const (
 	REQUEST_INITIALIZED requestState = iota
 	REQUEST_PARSING_HEADERS
 	REQUEST_PARSING_BODY
+	REQUEST_PARSING_CHUNK_SIZE
+	REQUEST_PARSING_CHUNK_DATA
+	REQUEST_PARSING_CHUNK_END
+	REQUEST_PARSING_TRAILERS
 	REQUEST_COMPLETED
 )
 
-// This is just user for debugging purposes
-// var STATE = [4]string{"REQUEST_INITIALIZED", "REQUEST_PARSING_HEADERS", "REQUEST_PARSING_BODY", "REQUEST_COMPLETED"}
+var stateNames = [...]string{"REQUEST_INITIALIZED", "REQUEST_PARSING_HEADERS", "REQUEST_PARSING_BODY", "REQUEST_PARSING_CHUNK_SIZE",
+	"REQUEST_PARSING_CHUNK_DATA", "REQUEST_PARSING_CHUNK_END", "REQUEST_PARSING_TRAILERS", "REQUEST_COMPLETED"}
+
+func (s requestState) String() string {
+	if s < 0 || int(s) >= len(stateNames) {
+		return "UNKNOWN"
+	}
+	return stateNames[s]
+}
 
 const CRLF = "\r\n"
 const INITIAL_BUFFER_SIZE = 8
 
-// TODO: case there is a Content-Length but no body at all, implement some check
+// RequestFromReader reads and parses the single request contained in reader,
+// returning as soon as it is complete. Data already received after the end of
+// the request is an error, to read several requests from the same connection
+// use a Reader instead.
 func RequestFromReader(reader io.Reader) (*Request, error) {
-	buffer := make([]byte, INITIAL_BUFFER_SIZE)
+	requestReader := NewReader(reader)
 
-	readToIndex := 0
-	request := Request{
-		state:   REQUEST_INITIALIZED,
-		Headers: headers.Headers{},
+	request, err := requestReader.ReadRequest()
+	if err != nil {
+		return nil, err
 	}
 
-	for request.state != REQUEST_COMPLETED {
-		if readToIndex >= len(buffer) {
-			// if buffer is full duplicate size/capacity
-			newBuffer := make([]byte, len(buffer)*2)
-			copy(newBuffer, buffer)
-			buffer = newBuffer
-		}
-
-		// READ INTO BUFFER
-		numBytesRead, err := reader.Read(buffer[readToIndex:])
-
-		if err != nil {
-			if err == io.EOF {
-				request.state = REQUEST_COMPLETED
-				if _, exists := request.Headers.Get("Content-Length"); exists {
-					// if there is a Body, we need to check edge case
-					// where we finish reading the request but body < Content-Length
-					// in this case we decided to return an error
-					// (because no match between actual body and what the header says)
-					contentLength, err := contentLengthInt(request.Headers)
-					if err != nil {
-						fmt.Println(err)
-						return nil, err
-					}
-					if len(request.Body) < contentLength {
-						fmt.Println(err)
-						return nil, errors.New("body is shorter than Content-Length")
-					}
-				}
-				break
-			}
-			fmt.Println(err)
-			return nil, err
+	// only what was already received is checked, reading more could block
+	// forever on a connection whose client waits for the response
+	if requestReader.readToIndex > 0 {
+		if _, exists := request.Headers.Get("Content-Length"); exists {
+			return nil, request.newParseError(request.offset, ErrBodyTooLong)
 		}
+		// e.g. a body was sent without Content-Length
+		return nil, request.newParseError(request.offset, ErrUnexpectedData)
+	}
 
-		// update/advance "pointer" after reading n bytes
-		readToIndex += numBytesRead
-
-		// PARSE FROM THE BUFFER
-		numBytesParsed, err := request.parse(buffer[:readToIndex])
-		if err != nil {
-			fmt.Println(err)
-			return nil, err
-		}
+	return request, nil
+}
 
-		// Shift remaining unparsed data to the beginning of the buffer
-		copy(buffer, buffer[numBytesParsed:])
-		readToIndex -= numBytesParsed
-	}
+func (r *Request) isCompleted() bool {
+	return r.state == REQUEST_COMPLETED
+}
 
-	return &request, nil
+// isHeadersDone reports whether the request-line and headers are parsed
+func (r *Request) isHeadersDone() bool {
+	return r.state != REQUEST_INITIALIZED && r.state != REQUEST_PARSING_HEADERS
 }
 
 /*
@@ -108,7 +127,7 @@ func (r *Request) parse(data []byte) (int, error) {
 	for r.state != REQUEST_COMPLETED {
 		n, err := r.parseSingle(data[totalBytesParsed:])
 		if err != nil {
-			return 0, err
+			return 0, r.newParseError(r.offset+totalBytesParsed, err)
 		}
 		totalBytesParsed += n
 		// If nothing was parse means we need to receive/read more data in order
@@ -117,6 +136,7 @@ func (r *Request) parse(data []byte) (int, error) {
 			break
 		}
 	}
+	r.offset += totalBytesParsed
 	return totalBytesParsed, nil
 }
 
@@ -142,12 +162,22 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 			return 0, err
 		}
 		if numBytesParsed == 0 {
+			if len(data) > r.limits.maxRequestLineBytes() {
+				// no end of line in sight
+				return 0, ErrRequestLineTooLong
+			}
 			// couldn't parse yet, more data needed
 			return 0, nil
 		}
+		if numBytesParsed-len(CRLF) > r.limits.maxRequestLineBytes() {
+			return 0, ErrRequestLineTooLong
+		}
 
 		// if bytes consumed then update requestLine and state
 		r.RequestLine = *requestLine
+		if err := r.parseURL(); err != nil {
+			return 0, err
+		}
 		r.state = REQUEST_PARSING_HEADERS
 
 		return numBytesParsed, nil
@@ -155,13 +185,34 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 	case REQUEST_PARSING_HEADERS:
 		// Parse HEADERS
 		// if request is done with request-line, start parsing headers
-		numBytesParsed, done, err := r.Headers.Parse(data)
+		numBytesParsed, done, err := r.parseFields(r.Headers, data)
 		if err != nil {
+			return 0, fmt.Errorf("%w: %w", ErrMalformedHeader, err)
+		}
+		if err := r.checkHeaderLimits(data, numBytesParsed, done); err != nil {
 			return 0, err
 		}
 
 		if done {
-			if _, exists := r.Headers.Get("Content-Length"); exists {
+			// the trailers (if any) get their own limits
+			r.headerBytes = 0
+			r.headerCount = 0
+
+			chunked, err := isChunked(r.Headers)
+			if err != nil {
+				return 0, err
+			}
+			if chunked {
+				r.state = REQUEST_PARSING_CHUNK_SIZE
+				return numBytesParsed, nil
+			} else if _, exists := r.Headers.Get("Content-Length"); exists {
+				contentLength, err := contentLengthInt(r.Headers)
+				if err != nil {
+					return 0, err
+				}
+				if r.limits.bodyTooLarge(contentLength) {
+					return 0, ErrBodyTooLarge
+				}
 				r.state = REQUEST_PARSING_BODY
 				return numBytesParsed, nil
 			} else {
@@ -182,28 +233,181 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 	case REQUEST_PARSING_BODY:
 		// Parse BODY
 		// Append the incoming data to body
-		r.Body = append(r.Body, data...)
-
 		contentLength, err := contentLengthInt(r.Headers)
 		if err != nil {
 			return 0, err
 		}
 
-		if len(r.Body) > contentLength {
-			return 0, errors.New("body is longer than Content-Length")
+		// Only take what belongs to this body, anything after that
+		// is the beginning of the next request on the connection
+		remaining := contentLength - r.bodyLength
+		if len(data) > remaining {
+			data = data[:remaining]
 		}
+		r.writeBody(data)
 
-		if len(r.Body) == contentLength {
+		if r.bodyLength == contentLength {
 			r.state = REQUEST_COMPLETED
 		}
 
 		return len(data), nil
 
+	case REQUEST_PARSING_CHUNK_SIZE:
+		// Parse CHUNK-SIZE line: chunk-size [ chunk-ext ] CRLF
+		chunkSize, numBytesParsed, err := parseChunkSize(data)
+		if err != nil {
+			return 0, err
+		}
+		if numBytesParsed == 0 {
+			// more data needed
+			return 0, nil
+		}
+
+		if r.limits.bodyTooLarge(r.bodyLength + chunkSize) {
+			return 0, ErrBodyTooLarge
+		}
+
+		if chunkSize == 0 {
+			// last-chunk, only the trailer section is left
+			r.state = REQUEST_PARSING_TRAILERS
+		} else {
+			r.chunkRemaining = chunkSize
+			r.state = REQUEST_PARSING_CHUNK_DATA
+		}
+		return numBytesParsed, nil
+
+	case REQUEST_PARSING_CHUNK_DATA:
+		// Parse CHUNK-DATA
+		// Append as much of the current chunk as we already have
+		if len(data) > r.chunkRemaining {
+			data = data[:r.chunkRemaining]
+		}
+		r.writeBody(data)
+		r.chunkRemaining -= len(data)
+
+		if r.chunkRemaining == 0 {
+			r.state = REQUEST_PARSING_CHUNK_END
+		}
+		return len(data), nil
+
+	case REQUEST_PARSING_CHUNK_END:
+		// Every chunk-data is followed by CRLF
+		if len(data) < len(CRLF) {
+			return 0, nil
+		}
+		if string(data[:len(CRLF)]) != CRLF {
+			return 0, fmt.Errorf("%w: missing CRLF after chunk data", ErrInvalidChunk)
+		}
+		r.state = REQUEST_PARSING_CHUNK_SIZE
+		return len(CRLF), nil
+
+	case REQUEST_PARSING_TRAILERS:
+		// Parse TRAILERS
+		// same format as the headers, ended by an empty line
+		numBytesParsed, done, err := r.parseFields(r.Trailers, data)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %w", ErrInvalidTrailer, err)
+		}
+		if err := r.checkHeaderLimits(data, numBytesParsed, done); err != nil {
+			return 0, err
+		}
+
+		if done {
+			if err := validateTrailers(r.Headers, r.Trailers); err != nil {
+				return 0, err
+			}
+			r.state = REQUEST_COMPLETED
+		}
+		return numBytesParsed, nil
+
 	default:
 		return 0, errors.New("error: unknown parser state")
 	}
 }
 
+// checkHeaderLimits keeps count of the header (or trailer) section parsed
+// so far and checks it against the limits. An incomplete field counts too,
+// otherwise a never ending header line would grow the buffer forever.
+func (r *Request) checkHeaderLimits(data []byte, numBytesParsed int, done bool) error {
+	r.headerBytes += numBytesParsed
+	if numBytesParsed > 0 && !done {
+		r.headerCount++
+	}
+
+	if r.headerCount > r.limits.maxHeaderCount() {
+		return ErrHeaderFieldsTooLarge
+	}
+	if numBytesParsed == 0 && r.headerBytes+len(data) > r.limits.maxHeaderBytes() {
+		return ErrHeaderFieldsTooLarge
+	}
+	if r.headerBytes > r.limits.maxHeaderBytes() {
+		return ErrHeaderFieldsTooLarge
+	}
+	return nil
+}
+
+// writeBody stores the decoded body bytes, either in Body
+// or in the pending data of a streamed body
+func (r *Request) writeBody(data []byte) {
+	r.bodyLength += len(data)
+	if r.streamBody {
+		r.pending = append(r.pending, data...)
+		return
+	}
+	r.Body = append(r.Body, data...)
+}
+
+// PathParam returns the value captured for name by the router,
+// or "" if there is no such parameter
+func (r *Request) PathParam(name string) string {
+	return r.PathParams[name]
+}
+
+// parseFields parses one header (or trailer) line into h
+func (r *Request) parseFields(h *headers.Headers, data []byte) (int, bool, error) {
+	if r.lenientHeaders {
+		return h.ParseLenient(data)
+	}
+	return h.Parse(data)
+}
+
+// BodyPending reports whether (part of) the body is still on the connection,
+// waiting to be read through BodyReader
+func (r *Request) BodyPending() bool {
+	return r.state != REQUEST_COMPLETED
+}
+
+// ExpectsContinue reports whether the client sent "Expect: 100-continue",
+// meaning it waits for a 100 Continue response before sending the body
+func (r *Request) ExpectsContinue() bool {
+	expect, exists := r.Headers.Get("Expect")
+	return exists && strings.EqualFold(strings.TrimSpace(expect), "100-continue")
+}
+
+// KeepAlive reports whether the client wants the connection to stay open
+// after this request is answered. HTTP/1.1 connections are persistent unless
+// the client sends "Connection: close", HTTP/1.0 ones are closed unless it
+// sends "Connection: keep-alive".
+func (r *Request) KeepAlive() bool {
+	persistent := r.RequestLine.HttpVersion != "1.0"
+
+	connection, exists := r.Headers.Get("Connection")
+	if !exists {
+		return persistent
+	}
+	// close wins wherever it appears
+	for _, option := range strings.Split(connection, ",") {
+		option = strings.TrimSpace(option)
+		if strings.EqualFold(option, "close") {
+			return false
+		}
+		if strings.EqualFold(option, "keep-alive") {
+			persistent = true
+		}
+	}
+	return persistent
+}
+
 func (r *Request) Print() {
 	fmt.Println("Request line:")
 	fmt.Println("- Method:", r.RequestLine.Method)
@@ -211,7 +415,7 @@ func (r *Request) Print() {
 	fmt.Println("- Version:", r.RequestLine.HttpVersion)
 	fmt.Println("")
 	fmt.Println("Headers:")
-	for key, value := range r.Headers {
+	for key, value := range r.Headers.All() {
 		fmt.Printf("- %s: %s\n", key, value)
 	}
 	if len(r.Body) > 0 {
@@ -219,5 +423,12 @@ func (r *Request) Print() {
 		fmt.Println("Body:")
 		fmt.Println(string(r.Body))
 	}
+	if r.Trailers.Len() > 0 {
+		fmt.Println("")
+		fmt.Println("Trailers:")
+		for key, value := range r.Trailers.All() {
+			fmt.Printf("- %s: %s\n", key, value)
+		}
+	}
 	// fmt.Println("State:", r.state)
 }
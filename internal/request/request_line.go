@@ -1,7 +1,7 @@
 package request
 
 import (
-	"errors"
+	"fmt"
 	"strings"
 )
 
@@ -34,7 +34,7 @@ func parseRequestLineFromString(requestLineString string) (*RequestLine, error)
 
 	// Validate RequestLine parts
 	if len(requestLineParts) != 3 {
-		return nil, errors.New("invalid request format")
+		return nil, fmt.Errorf("%w: expected 3 parts, got %d", ErrMalformedRequestLine, len(requestLineParts))
 	}
 
 	// RequestLine fields
@@ -43,30 +43,42 @@ func parseRequestLineFromString(requestLineString string) (*RequestLine, error)
 	version := requestLineParts[2]
 
 	//Validate version
-	versionParts := strings.Split(version, "/")
-	if len(versionParts) != 2 {
-		return nil, errors.New("invalid request http version format")
-	}
-	httpVersion := versionParts[1]
-	if httpVersion != "1.1" {
-		return nil, errors.New("invalid request version")
+	httpVersion, err := parseHTTPVersion(version)
+	if err != nil {
+		return nil, err
 	}
 
 	//Validate method
 	if !isValidHTTPMethod(method) {
-		return nil, errors.New("invalid request method")
+		return nil, fmt.Errorf("%w: %s", ErrInvalidMethod, method)
 	}
 
 	//Validate target
-	if !strings.HasPrefix(target, "/") {
-		return nil, errors.New("invalid request target")
+	parsedTarget, err := parseTarget(method, target)
+	if err != nil {
+		return nil, err
 	}
 
 	requestLine := RequestLine{
 		HttpVersion:   httpVersion,
 		RequestTarget: target,
+		Target:        parsedTarget,
 		Method:        method,
 	}
 
 	return &requestLine, nil
 }
+
+// parseHTTPVersion returns the version number of an HTTP-version ("HTTP/1.1"
+// gives "1.1"). Only 1.0 and 1.1 are supported, anything else (HTTP/2 sent as
+// text, or not a version at all) is reported as an unsupported version.
+func parseHTTPVersion(version string) (string, error) {
+	number, found := strings.CutPrefix(version, "HTTP/")
+	if !found {
+		return "", fmt.Errorf("%w: %q", ErrUnsupportedVersion, version)
+	}
+	if number != "1.0" && number != "1.1" {
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedVersion, number)
+	}
+	return number, nil
+}
@@ -0,0 +1,175 @@
+package request
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ORIGIN_FORM is the usual absolute path with an optional query ("/where?q=now")
+	ORIGIN_FORM TargetForm = iota
+	// ABSOLUTE_FORM is a complete URI, sent to proxies ("http://www.example.org/pub/WWW/")
+	ABSOLUTE_FORM
+	// AUTHORITY_FORM is host and port, only for CONNECT ("www.example.com:443")
+	AUTHORITY_FORM
+	// ASTERISK_FORM is "*", only for a server-wide OPTIONS
+	ASTERISK_FORM
+)
+
+// TargetForm is one of the four forms of request-target (RFC 9112 section 3.2)
+type TargetForm int
+
+var targetFormNames = map[TargetForm]string{
+	ORIGIN_FORM:    "origin-form",
+	ABSOLUTE_FORM:  "absolute-form",
+	AUTHORITY_FORM: "authority-form",
+	ASTERISK_FORM:  "asterisk-form",
+}
+
+func (f TargetForm) String() string {
+	if name, ok := targetFormNames[f]; ok {
+		return name
+	}
+	return fmt.Sprintf("TargetForm(%d)", int(f))
+}
+
+// Target is the request-target split in its parts.
+// Only the parts present in its form are set.
+type Target struct {
+	Form TargetForm
+	// Scheme is lowercased (absolute-form only)
+	Scheme string
+	// Authority is host[:port] (absolute and authority forms)
+	Authority string
+	// Path is as received, percent-encoded (origin and absolute forms,
+	// "/" for an absolute-form without path)
+	Path string
+	// RawQuery is the query without the "?"
+	RawQuery string
+}
+
+// parseTarget parses the request-target of a request with the given method
+func parseTarget(method, target string) (Target, error) {
+	for i := 0; i < len(target); i++ {
+		// only visible ASCII characters, and no fragment
+		if target[i] <= ' ' || target[i] >= 0x7f || target[i] == '#' {
+			return Target{}, fmt.Errorf("%w: invalid character in %q", ErrInvalidTarget, target)
+		}
+	}
+
+	switch {
+	case method == "CONNECT":
+		if !validAuthority(target, true) {
+			return Target{}, fmt.Errorf("%w: CONNECT needs host:port, got %q", ErrInvalidTarget, target)
+		}
+		return Target{Form: AUTHORITY_FORM, Authority: target}, nil
+	case target == "*":
+		if method != "OPTIONS" {
+			return Target{}, fmt.Errorf("%w: * is only valid for OPTIONS", ErrInvalidTarget)
+		}
+		return Target{Form: ASTERISK_FORM}, nil
+	case strings.HasPrefix(target, "/"):
+		path, query, _ := strings.Cut(target, "?")
+		return Target{Form: ORIGIN_FORM, Path: path, RawQuery: query}, nil
+	default:
+		return parseAbsoluteTarget(target)
+	}
+}
+
+// parseAbsoluteTarget parses an absolute-form target (scheme://authority/path?query)
+func parseAbsoluteTarget(target string) (Target, error) {
+	scheme, rest, found := strings.Cut(target, "://")
+	if !found || !validScheme(scheme) {
+		return Target{}, fmt.Errorf("%w: %s", ErrInvalidTarget, target)
+	}
+
+	rest, query, _ := strings.Cut(rest, "?")
+	authority, path := rest, "/"
+	if i := strings.Index(rest, "/"); i != -1 {
+		authority, path = rest[:i], rest[i:]
+	}
+	if !validAuthority(authority, false) {
+		return Target{}, fmt.Errorf("%w: invalid authority %q", ErrInvalidTarget, authority)
+	}
+
+	return Target{
+		Form:      ABSOLUTE_FORM,
+		Scheme:    strings.ToLower(scheme),
+		Authority: authority,
+		Path:      path,
+		RawQuery:  query,
+	}, nil
+}
+
+// validScheme reports whether scheme is ALPHA *( ALPHA / DIGIT / "+" / "-" / "." )
+func validScheme(scheme string) bool {
+	if scheme == "" || !isAlpha(scheme[0]) {
+		return false
+	}
+	for i := 1; i < len(scheme); i++ {
+		c := scheme[i]
+		if !isAlpha(c) && !('0' <= c && c <= '9') && c != '+' && c != '-' && c != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlpha(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+// validAuthority reports whether authority is host[:port], with the port
+// required if needPort. User info ("user:pass@host") is not accepted.
+func validAuthority(authority string, needPort bool) bool {
+	host, port, err := net.SplitHostPort(authority)
+	if err != nil {
+		// no port (or not a host at all)
+		if needPort {
+			return false
+		}
+		if strings.HasPrefix(authority, "[") && strings.HasSuffix(authority, "]") {
+			return validHost(authority[1:len(authority)-1], true)
+		}
+		return validHost(authority, false)
+	}
+
+	// only an IPv6 address (in brackets) can have colons
+	if !validHost(host, strings.Contains(host, ":")) {
+		return false
+	}
+	if port == "" {
+		return !needPort
+	}
+	for i := 0; i < len(port); i++ {
+		if port[i] < '0' || port[i] > '9' {
+			return false
+		}
+	}
+	n, err := strconv.Atoi(port)
+	return err == nil && n <= 65535
+}
+
+// validHost reports whether host is a name or IPv4 address (letters, digits
+// and the few other characters of a reg-name), or an IPv6 address if ipv6
+// (hex digits, colons, and dots for an embedded IPv4 address)
+func validHost(host string, ipv6 bool) bool {
+	if host == "" {
+		return false
+	}
+	for i := 0; i < len(host); i++ {
+		c := host[i]
+		switch {
+		case ipv6:
+			if !isHexDigit(rune(c)) && c != ':' && c != '.' {
+				return false
+			}
+		case isAlpha(c) || ('0' <= c && c <= '9') || c == '.':
+		case strings.IndexByte("-_~%!$&'()*+,;=", c) == -1:
+			return false
+		}
+	}
+	return true
+}
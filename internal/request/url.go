@@ -0,0 +1,113 @@
+package request
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// parseURL decodes and cleans the path of the request-target and parses its
+// query, once the request-line is parsed
+func (r *Request) parseURL() error {
+	target := r.RequestLine.Target
+
+	if target.Path != "" {
+		path, err := cleanPath(target.Path, r.strictPaths)
+		if err != nil {
+			return err
+		}
+		r.path = path
+	}
+
+	// pairs with an invalid encoding are dropped, as most servers do
+	r.query, _ = url.ParseQuery(target.RawQuery)
+	return nil
+}
+
+// cleanPath percent-decodes a path and normalizes it: "." and ".." segments
+// are resolved (never going above the root) and empty segments from duplicate
+// slashes removed, a trailing slash is kept. An encoded slash or backslash
+// separates segments like a plain slash once decoded. With strict, a segment
+// that is only a dot segment or contains a slash once decoded (e.g. "%2e%2e"
+// or "..%2f") is rejected instead, it's almost always a traversal attempt.
+func cleanPath(rawPath string, strict bool) (string, error) {
+	segments := strings.Split(strings.TrimPrefix(rawPath, "/"), "/")
+	cleaned := make([]string, 0, len(segments))
+	trailingSlash := false
+
+	for _, segment := range segments {
+		decoded, err := url.PathUnescape(segment)
+		if err != nil {
+			return "", fmt.Errorf("%w: %w", ErrInvalidTarget, err)
+		}
+		if strings.Contains(decoded, "\x00") {
+			return "", fmt.Errorf("%w: NUL byte in path", ErrInvalidTarget)
+		}
+		if strict && decoded != segment &&
+			(decoded == "." || decoded == ".." || strings.ContainsAny(decoded, "/\\")) {
+			return "", fmt.Errorf("%w: encoded traversal in path segment %q", ErrInvalidTarget, segment)
+		}
+
+		// a decoded "/" or "\\" still separates segments, so "..%2f" can't
+		// slip a dot segment past the normalization below
+		parts := strings.Split(strings.ReplaceAll(decoded, "\\", "/"), "/")
+		for _, part := range parts {
+			// the last segment tells if the path ends with a slash
+			trailingSlash = false
+			switch part {
+			case "", ".":
+				trailingSlash = true
+			case "..":
+				if len(cleaned) > 0 {
+					cleaned = cleaned[:len(cleaned)-1]
+				}
+				trailingSlash = true
+			default:
+				cleaned = append(cleaned, part)
+			}
+		}
+	}
+
+	path := "/" + strings.Join(cleaned, "/")
+	if trailingSlash && len(cleaned) > 0 {
+		path += "/"
+	}
+	return path, nil
+}
+
+// Path returns the path of the request-target percent-decoded and cleaned
+// ("/a/./b//../c%20d" gives "/a/c d"), or "" for targets without a path
+// (CONNECT host:port and OPTIONS *). This is the path to route by.
+func (r *Request) Path() string {
+	return r.path
+}
+
+// RawPath returns the path of the request-target as received (still encoded)
+func (r *Request) RawPath() string {
+	return r.RequestLine.Target.Path
+}
+
+// RawQuery returns the query of the request-target as received, without the "?"
+func (r *Request) RawQuery() string {
+	return r.RequestLine.Target.RawQuery
+}
+
+// Query returns the decoded query parameters, a parameter can have several
+// values ("?tag=a&tag=b"). The result belongs to the request.
+func (r *Request) Query() url.Values {
+	if r.query == nil {
+		r.query = url.Values{}
+	}
+	return r.query
+}
+
+// QueryParam returns the first value of the query parameter name,
+// or "" if there is no such parameter
+func (r *Request) QueryParam(name string) string {
+	return r.query.Get(name)
+}
+
+// QueryValues returns every value of the query parameter name
+func (r *Request) QueryValues(name string) []string {
+	return r.query[name]
+}
@@ -1,38 +1,28 @@
 package request
 
 import (
-	"errors"
-	"net/http"
+	"fmt"
 	"strconv"
 
 	"github.com/agustin-carnevale/tcp-to-http/internal/headers"
 )
 
-var validMethods = map[string]struct{}{
-	http.MethodGet:     {},
-	http.MethodPost:    {},
-	http.MethodPut:     {},
-	http.MethodPatch:   {},
-	http.MethodDelete:  {},
-	http.MethodHead:    {},
-	http.MethodOptions: {},
-	http.MethodTrace:   {},
-}
-
+// isValidHTTPMethod reports whether method can be a method. The set of
+// methods is extensible (WebDAV's PROPFIND, PURGE...) so any token is,
+// it's up to the server to tell which ones it implements.
 func isValidHTTPMethod(method string) bool {
-	_, exists := validMethods[method]
-	return exists
+	return headers.IsToken(method)
 }
 
-func contentLengthInt(headers headers.Headers) (int, error) {
+func contentLengthInt(headers *headers.Headers) (int, error) {
 	contentLengthString, exists := headers.Get("Content-Length")
 	if !exists {
-		return 0, errors.New("Content-Length is not defined")
+		return 0, fmt.Errorf("%w: not defined", ErrInvalidContentLength)
 	}
 
 	contentLength, err := strconv.Atoi(contentLengthString)
-	if err != nil {
-		return 0, errors.New("invalid Content-Length")
+	if err != nil || contentLength < 0 || contentLengthString[0] == '+' {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidContentLength, contentLengthString)
 	}
 
 	return contentLength, nil
@@ -0,0 +1,12 @@
+package response
+
+import "errors"
+
+// Errors returned by the Writer when the body doesn't match how the
+// response declared it, sending it anyway would corrupt the connection
+var (
+	ErrBodyNotAllowed          = errors.New("response status does not allow a body")
+	ErrContentLengthExceeded   = errors.New("response body longer than Content-Length")
+	ErrContentLengthNotReached = errors.New("response body shorter than Content-Length")
+	ErrInvalidContentLength    = errors.New("invalid response Content-Length")
+)
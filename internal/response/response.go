@@ -1,32 +1,15 @@
 package response
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"strconv"
+	"strings"
 
 	"github.com/agustin-carnevale/tcp-to-http/internal/headers"
 )
 
-type StatusCode int
-
-const (
-	StatusOK        StatusCode = 200
-	StatusCreated   StatusCode = 201
-	StatusAccepted  StatusCode = 202
-	StatusNoContent StatusCode = 204
-
-	StatusBadRequest   StatusCode = 400
-	StatusUnauthorized StatusCode = 401
-	StatusForbidden    StatusCode = 403
-	StatusNotFound     StatusCode = 404
-
-	StatusInternalServerError StatusCode = 500
-	StatusNotImplemented      StatusCode = 501
-	StatusBadGateway          StatusCode = 502
-	StatusServiceUnavailable  StatusCode = 503
-)
-
 const CRLF = "\r\n"
 
 const (
@@ -38,66 +21,345 @@ const (
 
 type WriterState int
 
+// How the body is delimited, decided from the headers
+const (
+	// the body is buffered until the handler is done (then sent with a
+	// Content-Length) or until it gets over BufferSize (then sent chunked)
+	framingBuffered bodyFraming = iota
+	framingContentLength
+	framingChunked
+	// the body ends when the connection is closed
+	framingClose
+	// 204 and 304 responses have no body
+	framingNoBody
+)
+
+type bodyFraming int
+
+// DefaultBufferSize is how much of a body without a declared length is
+// buffered when Writer.BufferSize is not set
+const DefaultBufferSize = 4 * 1024
+
 type Writer struct {
 	Connection net.Conn
-	state      WriterState
+	// Version is the HTTP version of the request being answered, echoed in
+	// the status line ("1.1" if empty). HTTP/1.0 clients don't understand
+	// chunked bodies, so theirs are delimited by closing the connection.
+	Version string
+	// Method is the method of the request being answered. The response to a
+	// HEAD request gets the headers a GET would, but what the handler writes
+	// of the body is discarded.
+	Method string
+	// BufferSize is how much of a body without Content-Length is kept to
+	// send it with one, bigger bodies are sent chunked (0: DefaultBufferSize)
+	BufferSize int
+
+	state WriterState
+	// headers already sent with the status line, used to decide
+	// if the connection can be reused once the response is done
+	headers *headers.Headers
+	// what was sent so far, for whoever wraps the handler
+	// (logging, metrics...) to observe the response
+	statusCode   StatusCode
+	bytesWritten int
+
+	framing       bodyFraming
+	contentLength int
+	buffer        []byte
+	chunkedDone   bool
 }
 
+// Write writes body data (e.g. when used with io.Copy), framed the way
+// the headers declared it: it can't go over a declared Content-Length,
+// it's chunked with a chunked Transfer-Encoding, and without either it's
+// buffered until Finish, or streamed (chunked) once it doesn't fit in BufferSize.
 func (w *Writer) Write(data []byte) (int, error) {
+	if w.state != WriteBody {
+		return 0, fmt.Errorf("cannot write body in state %d", w.state)
+	}
+
+	switch w.framing {
+	case framingBuffered:
+		w.buffer = append(w.buffer, data...)
+		if len(w.buffer) > w.bufferSize() {
+			// too big to wait for the end, stream it
+			if err := w.startStreaming(); err != nil {
+				return 0, err
+			}
+		}
+		return len(data), nil
+	case framingContentLength:
+		if w.bytesWritten+len(data) > w.contentLength {
+			return 0, fmt.Errorf("%w: %d bytes declared", ErrContentLengthExceeded, w.contentLength)
+		}
+		return w.writeBody(data)
+	case framingChunked:
+		if len(data) == 0 {
+			// an empty chunk would end the body
+			return 0, nil
+		}
+		if _, err := w.WriteChunkedBody(data); err != nil {
+			return 0, err
+		}
+		return len(data), nil
+	case framingNoBody:
+		if len(data) > 0 {
+			return 0, fmt.Errorf("%w: %d", ErrBodyNotAllowed, w.statusCode)
+		}
+		return 0, nil
+	default:
+		return w.writeBody(data)
+	}
+}
+
+// writeBody sends body data to the connection as is, counting it
+func (w *Writer) writeBody(data []byte) (int, error) {
+	if w.isHead() {
+		return len(data), nil
+	}
+	n, err := w.write(data)
+	w.bytesWritten += n
+	return n, err
+}
+
+// write sends data to the connection without counting it as body
+// (status line, headers, chunk sizes...)
+func (w *Writer) write(data []byte) (int, error) {
 	return w.Connection.Write(data)
 }
 
+// State returns what the writer expects next, e.g. WriteStatusLine
+// means nothing was written yet
+func (w *Writer) State() WriterState {
+	return w.state
+}
+
+// StatusCode returns the status code of the response,
+// or 0 if the status line was not written yet
+func (w *Writer) StatusCode() StatusCode {
+	return w.statusCode
+}
+
+// BytesWritten returns the number of body bytes written so far
+// (not counting the chunked encoding framing), including the ones
+// still buffered to be sent by Finish
+func (w *Writer) BytesWritten() int {
+	if w.isHead() {
+		return w.bytesWritten
+	}
+	return w.bytesWritten + len(w.buffer)
+}
+
+func (w *Writer) version() string {
+	if w.Version == "" {
+		return "1.1"
+	}
+	return w.Version
+}
+
+func (w *Writer) isHTTP10() bool {
+	return w.version() == "1.0"
+}
+
+func (w *Writer) isHead() bool {
+	return w.Method == "HEAD"
+}
+
+func (w *Writer) bufferSize() int {
+	if w.BufferSize > 0 {
+		return w.BufferSize
+	}
+	return DefaultBufferSize
+}
+
+// WriteStatusLine writes the status line with the standard reason phrase
+// of statusCode (an empty one if the code is unknown)
 func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
+	return w.WriteStatusLineWithReason(statusCode, statusCode.Text())
+}
+
+// WriteStatusLineWithReason writes the status line with a custom reason phrase
+func (w *Writer) WriteStatusLineWithReason(statusCode StatusCode, reason string) error {
 	if w.state != WriteStatusLine {
 		return fmt.Errorf("cannot write status line in state %d", w.state)
 	}
+	if !statusCode.IsValid() {
+		return fmt.Errorf("invalid status code %d", statusCode)
+	}
+	if !validReasonPhrase(reason) {
+		return fmt.Errorf("invalid reason phrase %q", reason)
+	}
 	defer func() { w.state = WriteHeaders }()
 
-	var statusLine string
-	switch statusCode {
-	case StatusOK:
-		statusLine = "HTTP/1.1 200 OK"
-	case StatusBadRequest:
-		statusLine = "HTTP/1.1 400 Bad Request"
-	case StatusInternalServerError:
-		statusLine = "HTTP/1.1 500 Internal Server Error"
-	default:
-		statusLine = fmt.Sprintf("HTTP/1.1 %d ", statusCode)
-	}
+	statusLine := fmt.Sprintf("HTTP/%s %d %s", w.version(), statusCode, reason)
 	// add '\r\n' at the end of line
 	statusLine += CRLF
 
-	_, err := w.Write([]byte(statusLine))
+	w.statusCode = statusCode
+	_, err := w.write([]byte(statusLine))
 	return err
 }
 
-func GetDefaultHeaders(contentLen int) headers.Headers {
-	return headers.Headers{
-		"content-length": strconv.Itoa(contentLen),
-		"connection":     "close",
-		"content-type":   "text/plain",
-	}
+func GetDefaultHeaders(contentLen int) *headers.Headers {
+	h := headers.NewHeaders()
+	h.Set("Content-Length", strconv.Itoa(contentLen))
+	h.Set("Content-Type", "text/plain")
+	return h
 }
 
-func (w *Writer) WriteHeaders(headers headers.Headers, areTrailers bool) error {
+func (w *Writer) WriteHeaders(h *headers.Headers, areTrailers bool) error {
 	if w.state != WriteHeaders && !areTrailers {
 		return fmt.Errorf("cannot write headers in state %d", w.state)
 	}
+	if err := validateFields(h); err != nil {
+		return err
+	}
+	if areTrailers {
+		return w.writeFields(h)
+	}
+
+	framing, contentLength, err := w.bodyFraming(h)
+	if err != nil {
+		return err
+	}
 	defer func() { w.state = WriteBody }()
 
+	if _, exists := h.Get("Content-Length"); exists && framing == framingNoBody {
+		// 204 and 304 responses can't declare a length
+		h = h.Clone()
+		h.Del("Content-Length")
+	}
+
+	if framing == framingChunked && w.isHTTP10() {
+		// the body ends when the connection is closed instead
+		h = h.Clone()
+		h.Del("Transfer-Encoding")
+		h.Del("Trailer")
+		framing = framingClose
+	}
+
+	w.framing = framing
+	w.contentLength = contentLength
+
+	if framing == framingBuffered {
+		// sent with the body, once we know how to frame it (a copy,
+		// so adding the framing header doesn't change h)
+		w.headers = h.Clone()
+		return nil
+	}
+
+	w.headers = h
+	return w.writeFields(h)
+}
+
+// bodyFraming returns how the body of a response with headers h is delimited
+func (w *Writer) bodyFraming(h *headers.Headers) (bodyFraming, int, error) {
+	if w.statusCode == StatusNoContent || w.statusCode == StatusNotModified {
+		return framingNoBody, 0, nil
+	}
+
+	if transferEncoding, exists := h.Get("Transfer-Encoding"); exists {
+		codings := strings.Split(transferEncoding, ",")
+		if strings.EqualFold(strings.TrimSpace(codings[len(codings)-1]), "chunked") {
+			return framingChunked, 0, nil
+		}
+		return framingClose, 0, nil
+	}
+
+	if value, exists := h.Get("Content-Length"); exists {
+		contentLength, err := strconv.Atoi(value)
+		if err != nil || contentLength < 0 || value[0] == '+' {
+			return 0, 0, fmt.Errorf("%w: %q", ErrInvalidContentLength, value)
+		}
+		return framingContentLength, contentLength, nil
+	}
+
+	return framingBuffered, 0, nil
+}
+
+// startStreaming sends the buffered headers declaring a chunked body, and
+// what was buffered of the body as its first chunk. For HTTP/1.0 the headers
+// declare no length, the body ends when the connection is closed.
+func (w *Writer) startStreaming() error {
+	if w.isHTTP10() {
+		w.framing = framingClose
+	} else {
+		w.headers.Set("Transfer-Encoding", "chunked")
+		w.framing = framingChunked
+	}
+	if err := w.writeFields(w.headers); err != nil {
+		return err
+	}
+
+	buffer := w.buffer
+	w.buffer = nil
+	if len(buffer) > 0 {
+		if _, err := w.WriteChunkedBody(buffer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateFields checks every field can be sent as is: a value with a CR
+// or LF (e.g. copied from a proxied response) would inject fields
+func validateFields(h *headers.Headers) error {
+	for key, value := range h.All() {
+		if !headers.ValidFieldName(key) {
+			return fmt.Errorf("invalid header name %q", key)
+		}
+		if !headers.ValidFieldValue(value) {
+			return fmt.Errorf("invalid value for header %s: %q", key, value)
+		}
+	}
+	return nil
+}
+
+// writeFields writes header fields followed by the empty line ending them
+func (w *Writer) writeFields(h *headers.Headers) error {
 	headersString := ""
-	for key, value := range headers {
+	for key, value := range h.All() {
 		header := key + ": " + value + CRLF
 		headersString += header
 	}
 
 	// add '\r\n' at the end of all headers
 	headersString += CRLF
-	_, err := w.Write([]byte(headersString))
+	_, err := w.write([]byte(headersString))
 
 	return err
 }
 
+// WriteInformational writes an interim 1xx response (e.g. 100 Continue,
+// or 103 Early Hints with Link headers) before the final response.
+// It can be called several times, as long as the final status line
+// was not written yet. h can be nil.
+func (w *Writer) WriteInformational(statusCode StatusCode, h *headers.Headers) error {
+	if w.state != WriteStatusLine {
+		return fmt.Errorf("cannot write informational response in state %d", w.state)
+	}
+	if w.isHTTP10() {
+		// 1xx responses didn't exist yet, HTTP/1.0 clients can't tell
+		// them from the final one, so they are just not sent
+		return nil
+	}
+	// 101 Switching Protocols is the last response on HTTP/1.1
+	if statusCode < 100 || statusCode > 199 || statusCode == StatusSwitchingProtocols {
+		return fmt.Errorf("invalid informational status code %d", statusCode)
+	}
+	if err := validateFields(h); err != nil {
+		return err
+	}
+
+	statusLine := fmt.Sprintf("HTTP/%s %d %s", w.version(), statusCode, statusCode.Text()) + CRLF
+	_, err := w.write([]byte(statusLine))
+	if err != nil {
+		return err
+	}
+
+	return w.writeFields(h)
+}
+
 func (w *Writer) WriteBody(body []byte) (int, error) {
 	if w.state != WriteBody {
 		return 0, fmt.Errorf("cannot write body in state %d", w.state)
@@ -105,37 +367,171 @@ func (w *Writer) WriteBody(body []byte) (int, error) {
 	return w.Write(body)
 }
 
+// WriteChunkedBody writes p as one chunk. Without a declared length, the
+// body becomes chunked (even if it would have fit in the buffer). For
+// HTTP/1.0, p is written as is (the body is delimited by closing).
 func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
+	if err := w.checkChunked(); err != nil {
+		return 0, err
+	}
+	if w.framing == framingClose || w.isHead() {
+		return w.writeBody(p)
+	}
+
 	chunkLength := fmt.Sprintf("%X", len(p)) //uppercase hex
 
-	n1, err := w.Write([]byte(chunkLength))
+	n1, err := w.write([]byte(chunkLength))
 	if err != nil {
 		return n1, err
 	}
-	n2, err := w.Write([]byte(CRLF))
+	n2, err := w.write([]byte(CRLF))
 	if err != nil {
 		return n1 + n2, err
 	}
-	n3, err := w.Write(p)
+	n3, err := w.writeBody(p)
 	if err != nil {
 		return n1 + n2 + n3, err
 	}
-	n4, err := w.Write([]byte(CRLF))
+	n4, err := w.write([]byte(CRLF))
 	return n1 + n2 + n3 + n4, err
+}
 
+// checkChunked checks the body can be written as chunks, which is the case
+// for a chunked (or close-delimited) body that didn't end yet and a buffered one
+func (w *Writer) checkChunked() error {
+	if w.state != WriteBody {
+		return fmt.Errorf("cannot write body in state %d", w.state)
+	}
+	switch {
+	case w.chunkedDone:
+		return errors.New("chunked body already ended")
+	case w.framing == framingBuffered:
+		return w.startStreaming()
+	case w.framing != framingChunked && w.framing != framingClose:
+		return errors.New("response body is not chunked")
+	}
+	return nil
 }
 
 func (w *Writer) WriteChunkedBodyDone(hasTrailers bool) (int, error) {
+	if err := w.checkChunked(); err != nil {
+		return 0, err
+	}
+	w.chunkedDone = true
+	if w.framing == framingClose || w.isHead() {
+		// nothing marks the end, closing the connection does
+		// (or there is no body at all)
+		return 0, nil
+	}
+
 	endOfBody := "0" + CRLF
 	if !hasTrailers {
 		endOfBody += CRLF
 	}
-	return w.Write([]byte(endOfBody))
+	return w.write([]byte(endOfBody))
+}
+
+// WriteTrailers writes the trailer fields after WriteChunkedBodyDone(true).
+// The trailer section ends with the same empty line as the headers do.
+// Only chunked bodies have trailers, otherwise (or for HEAD) they are dropped.
+func (w *Writer) WriteTrailers(h *headers.Headers) error {
+	if w.framing != framingChunked || w.isHead() {
+		return nil
+	}
+	return w.WriteHeaders(h, true)
+}
+
+// Flush sends the headers and what is buffered of the body right away.
+// Without a declared length, the body is sent chunked from then on.
+func (w *Writer) Flush() error {
+	if w.state != WriteBody || w.framing != framingBuffered {
+		return nil
+	}
+	return w.startStreaming()
 }
 
-func (w *Writer) WriteTrailers(h headers.Headers) error {
-	w.WriteHeaders(h, true)
-	w.Write([]byte(CRLF))
+// Finish completes the response once the handler is done with it: headers
+// never written are sent (empty), a buffered body is sent with its
+// Content-Length and a chunked one gets its last chunk. It fails if the body
+// is shorter than its declared Content-Length (unless answering HEAD), in
+// which case the connection can't be reused. Calling it more than once has
+// no effect.
+func (w *Writer) Finish() error {
+	if w.state == WriteStatusLine {
+		// nothing written, there is no response to finish
+		return nil
+	}
+	if w.state == WriteHeaders {
+		if err := w.WriteHeaders(headers.NewHeaders(), false); err != nil {
+			return err
+		}
+	}
 
+	switch w.framing {
+	case framingBuffered:
+		buffer := w.buffer
+		w.buffer = nil
+		w.headers.Set("Content-Length", strconv.Itoa(len(buffer)))
+		w.framing = framingContentLength
+		w.contentLength = len(buffer)
+		if err := w.writeFields(w.headers); err != nil {
+			return err
+		}
+		_, err := w.writeBody(buffer)
+		return err
+	case framingChunked:
+		if !w.chunkedDone {
+			_, err := w.WriteChunkedBodyDone(false)
+			return err
+		}
+	case framingContentLength:
+		if w.bytesWritten < w.contentLength && !w.isHead() {
+			return fmt.Errorf("%w: %d of %d bytes written", ErrContentLengthNotReached, w.bytesWritten, w.contentLength)
+		}
+	}
 	return nil
 }
+
+// KeepAlive reports whether the connection can be reused for another request
+// once this response is done. That is only the case when the response did not
+// ask to close the connection and its body length is known to the client
+// (Content-Length or chunked Transfer-Encoding), otherwise the end of the body
+// is signaled by closing the connection. An HTTP/1.0 client expects the
+// connection to be closed unless the response has "Connection: keep-alive".
+func (w *Writer) KeepAlive() bool {
+	if w.headers == nil {
+		// nothing (or only a status line) was written
+		return false
+	}
+
+	keepAlive := false
+	if connection, exists := w.headers.Get("Connection"); exists {
+		for _, option := range strings.Split(connection, ",") {
+			option = strings.TrimSpace(option)
+			if strings.EqualFold(option, "close") {
+				return false
+			}
+			if strings.EqualFold(option, "keep-alive") {
+				keepAlive = true
+			}
+		}
+	}
+	if w.isHTTP10() && !keepAlive {
+		return false
+	}
+	if w.isHead() {
+		// no body, nothing to delimit
+		return true
+	}
+
+	switch w.framing {
+	case framingContentLength:
+		return w.bytesWritten == w.contentLength
+	case framingChunked:
+		return w.chunkedDone
+	case framingNoBody:
+		return true
+	default:
+		return false
+	}
+}
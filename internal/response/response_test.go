@@ -0,0 +1,298 @@
+package response
+
+import (
+	"io"
+	"net"
+	"testing"
+
+	"github.com/agustin-carnevale/tcp-to-http/internal/headers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// captureWriter returns a Writer and a function returning everything
+// written to it once the writer is done
+func captureWriter(t *testing.T) (*Writer, func() string) {
+	t.Helper()
+	serverConn, clientConn := net.Pipe()
+	output := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(clientConn)
+		output <- string(data)
+	}()
+	return &Writer{Connection: serverConn}, func() string {
+		serverConn.Close()
+		return <-output
+	}
+}
+
+func TestWriteStatusLine(t *testing.T) {
+	tests := []struct {
+		statusCode StatusCode
+		statusLine string
+	}{
+		{StatusOK, "HTTP/1.1 200 OK\r\n"},
+		{StatusNotFound, "HTTP/1.1 404 Not Found\r\n"},
+		// unknown code, empty reason phrase
+		{StatusCode(418), "HTTP/1.1 418 \r\n"},
+		{StatusNetworkAuthenticationRequired, "HTTP/1.1 511 Network Authentication Required\r\n"},
+	}
+	for _, tt := range tests {
+		w, output := captureWriter(t)
+		require.NoError(t, w.WriteStatusLine(tt.statusCode))
+		assert.Equal(t, tt.statusLine, output())
+	}
+
+	// Test: Custom reason phrase
+	w, output := captureWriter(t)
+	require.NoError(t, w.WriteStatusLineWithReason(StatusOK, "All Good"))
+	assert.Equal(t, "HTTP/1.1 200 All Good\r\n", output())
+
+	// Test: Invalid status codes and reason phrases
+	w, output = captureWriter(t)
+	assert.Error(t, w.WriteStatusLine(99))
+	assert.Error(t, w.WriteStatusLine(1000))
+	assert.Error(t, w.WriteStatusLineWithReason(StatusOK, "OK\r\nX-Injected: 1"))
+	assert.Equal(t, "", output())
+
+	// Test: Status line can only be written once
+	w, output = captureWriter(t)
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	assert.Error(t, w.WriteStatusLine(StatusOK))
+	output()
+}
+
+func TestStatusCodeText(t *testing.T) {
+	assert.Equal(t, "Continue", StatusContinue.Text())
+	assert.Equal(t, "Content Too Large", StatusContentTooLarge.Text())
+	assert.Equal(t, "", StatusCode(299).Text())
+}
+
+func TestWriteInformational(t *testing.T) {
+	// Test: Interim responses before the final one
+	w, output := captureWriter(t)
+	require.NoError(t, w.WriteInformational(StatusContinue, nil))
+	hints := headers.NewHeaders()
+	hints.Set("Link", "</style.css>; rel=preload; as=style")
+	require.NoError(t, w.WriteInformational(StatusEarlyHints, hints))
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	assert.Equal(t, "HTTP/1.1 100 Continue\r\n\r\n"+
+		"HTTP/1.1 103 Early Hints\r\nLink: </style.css>; rel=preload; as=style\r\n\r\n"+
+		"HTTP/1.1 200 OK\r\n", output())
+
+	// Test: Not a 1xx status, or after the final status line
+	w, output = captureWriter(t)
+	assert.Error(t, w.WriteInformational(StatusOK, nil))
+	assert.Error(t, w.WriteInformational(StatusSwitchingProtocols, nil))
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	assert.Error(t, w.WriteInformational(StatusContinue, nil))
+	output()
+}
+
+func TestWriterBodyFraming(t *testing.T) {
+	// Test: Small body without length, sent with a Content-Length
+	w, output := captureWriter(t)
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(headers.NewHeaders(), false))
+	_, err := w.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.True(t, w.KeepAlive())
+	assert.Equal(t, 5, w.BytesWritten())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello", output())
+
+	// Test: Body over the buffer size, sent chunked
+	w, output = captureWriter(t)
+	w.BufferSize = 4
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(headers.NewHeaders(), false))
+	_, err = w.Write([]byte("hel"))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("lo"))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("!"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.True(t, w.KeepAlive())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n"+
+		"5\r\nhello\r\n1\r\n!\r\n0\r\n\r\n", output())
+
+	// Test: Headers never written
+	w, output = captureWriter(t)
+	require.NoError(t, w.WriteStatusLine(StatusNotFound))
+	require.NoError(t, w.Finish())
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 404 Not Found\r\nContent-Length: 0\r\n\r\n", output())
+
+	// Test: Declared Content-Length is enforced
+	w, output = captureWriter(t)
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	h := headers.NewHeaders()
+	h.Set("Content-Length", "3")
+	require.NoError(t, w.WriteHeaders(h, false))
+	_, err = w.Write([]byte("hello"))
+	assert.ErrorIs(t, err, ErrContentLengthExceeded)
+	_, err = w.Write([]byte("hi"))
+	require.NoError(t, err)
+	assert.ErrorIs(t, w.Finish(), ErrContentLengthNotReached)
+	assert.False(t, w.KeepAlive())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 3\r\n\r\nhi", output())
+
+	// Test: Invalid Content-Length
+	w, output = captureWriter(t)
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	h.Set("Content-Length", "-1")
+	assert.ErrorIs(t, w.WriteHeaders(h, false), ErrInvalidContentLength)
+	h.Set("Content-Length", "+3")
+	assert.ErrorIs(t, w.WriteHeaders(h, false), ErrInvalidContentLength)
+	assert.Equal(t, WriteHeaders, w.State())
+	output()
+
+	// Test: No body allowed
+	w, output = captureWriter(t)
+	require.NoError(t, w.WriteStatusLine(StatusNoContent))
+	require.NoError(t, w.WriteHeaders(headers.NewHeaders(), false))
+	_, err = w.Write([]byte("hello"))
+	assert.ErrorIs(t, err, ErrBodyNotAllowed)
+	require.NoError(t, w.Finish())
+	assert.True(t, w.KeepAlive())
+	assert.Equal(t, "HTTP/1.1 204 No Content\r\n\r\n", output())
+
+	// Test: Content-Length is dropped from a 204
+	w, output = captureWriter(t)
+	require.NoError(t, w.WriteStatusLine(StatusNoContent))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(0), false))
+	require.NoError(t, w.Finish())
+	assert.True(t, w.KeepAlive())
+	assert.Equal(t, "HTTP/1.1 204 No Content\r\nContent-Type: text/plain\r\n\r\n", output())
+}
+
+func TestWriterHead(t *testing.T) {
+	// Test: Declared Content-Length without a body
+	w, output := captureWriter(t)
+	w.Method = "HEAD"
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5), false))
+	require.NoError(t, w.Finish())
+	assert.True(t, w.KeepAlive())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 5\r\nContent-Type: text/plain\r\n\r\n", output())
+
+	// Test: Buffered body gives its length, but is not sent
+	w, output = captureWriter(t)
+	w.Method = "HEAD"
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(headers.NewHeaders(), false))
+	_, err := w.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.True(t, w.KeepAlive())
+	assert.Equal(t, 0, w.BytesWritten())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\n", output())
+
+	// Test: Chunked body is not sent
+	w, output = captureWriter(t)
+	w.Method = "HEAD"
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	h := headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	require.NoError(t, w.WriteHeaders(h, false))
+	_, err = w.WriteChunkedBody([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.True(t, w.KeepAlive())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n", output())
+}
+
+func TestWriteHeaders(t *testing.T) {
+	// Test: Headers sent in order, one line per cookie
+	w, output := captureWriter(t)
+	h := GetDefaultHeaders(2)
+	h.Add("Set-Cookie", "a=1")
+	h.Add("Set-Cookie", "b=2")
+	h.Add("Cache-Control", "no-cache")
+	h.Add("Cache-Control", "no-store")
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(h, false))
+	_, err := w.Write([]byte("ok"))
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Length: 2\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"Set-Cookie: a=1\r\n"+
+		"Set-Cookie: b=2\r\n"+
+		"Cache-Control: no-cache, no-store\r\n"+
+		"\r\n"+
+		"ok", output())
+}
+
+func TestWriteHeadersInvalid(t *testing.T) {
+	// Test: Values that would inject fields are never sent
+	w, output := captureWriter(t)
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	h := GetDefaultHeaders(0)
+	h.Set("Location", "/next\r\nSet-Cookie: session=stolen")
+	assert.Error(t, w.WriteHeaders(h, false))
+	assert.Equal(t, WriteHeaders, w.State())
+
+	h = GetDefaultHeaders(0)
+	h.Set("Bad Name", "value")
+	assert.Error(t, w.WriteHeaders(h, false))
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n", output())
+}
+
+func TestWriterHTTP10(t *testing.T) {
+	// Test: Version echoed, no interim responses
+	w, output := captureWriter(t)
+	w.Version = "1.0"
+	require.NoError(t, w.WriteInformational(StatusContinue, nil))
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(2), false))
+	_, err := w.Write([]byte("ok"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.False(t, w.KeepAlive())
+	assert.Equal(t, "HTTP/1.0 200 OK\r\nContent-Length: 2\r\nContent-Type: text/plain\r\n\r\nok", output())
+
+	// Test: Large body delimited by closing the connection instead of chunked
+	w, output = captureWriter(t)
+	w.Version = "1.0"
+	w.BufferSize = 4
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(headers.NewHeaders(), false))
+	_, err = w.Write([]byte("hello"))
+	require.NoError(t, err)
+	_, err = w.Write([]byte(" world"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.False(t, w.KeepAlive())
+	assert.Equal(t, "HTTP/1.0 200 OK\r\n\r\nhello world", output())
+
+	// Test: Declared chunked body sent as is, trailers dropped
+	w, output = captureWriter(t)
+	w.Version = "1.0"
+	h := headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	h.Set("Trailer", "X-Checksum")
+	trailers := headers.NewHeaders()
+	trailers.Set("X-Checksum", "abc")
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(h, false))
+	_, err = w.WriteChunkedBody([]byte("hello"))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBodyDone(true)
+	require.NoError(t, err)
+	require.NoError(t, w.WriteTrailers(trailers))
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.0 200 OK\r\n\r\nhello", output())
+
+	// Test: Keep-alive only when the response says so
+	w, output = captureWriter(t)
+	w.Version = "1.0"
+	h = GetDefaultHeaders(0)
+	h.Set("Connection", "keep-alive")
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(h, false))
+	require.NoError(t, w.Finish())
+	assert.True(t, w.KeepAlive())
+	output()
+}
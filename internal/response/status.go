@@ -0,0 +1,141 @@
+package response
+
+type StatusCode int
+
+// Status codes from RFC 9110 (plus a few widely used ones from other RFCs)
+const (
+	StatusContinue           StatusCode = 100
+	StatusSwitchingProtocols StatusCode = 101
+	StatusEarlyHints         StatusCode = 103 // RFC 8297
+
+	StatusOK                   StatusCode = 200
+	StatusCreated              StatusCode = 201
+	StatusAccepted             StatusCode = 202
+	StatusNonAuthoritativeInfo StatusCode = 203
+	StatusNoContent            StatusCode = 204
+	StatusResetContent         StatusCode = 205
+	StatusPartialContent       StatusCode = 206
+
+	StatusMultipleChoices   StatusCode = 300
+	StatusMovedPermanently  StatusCode = 301
+	StatusFound             StatusCode = 302
+	StatusSeeOther          StatusCode = 303
+	StatusNotModified       StatusCode = 304
+	StatusUseProxy          StatusCode = 305
+	StatusTemporaryRedirect StatusCode = 307
+	StatusPermanentRedirect StatusCode = 308
+
+	StatusBadRequest                    StatusCode = 400
+	StatusUnauthorized                  StatusCode = 401
+	StatusPaymentRequired               StatusCode = 402
+	StatusForbidden                     StatusCode = 403
+	StatusNotFound                      StatusCode = 404
+	StatusMethodNotAllowed              StatusCode = 405
+	StatusNotAcceptable                 StatusCode = 406
+	StatusProxyAuthRequired             StatusCode = 407
+	StatusRequestTimeout                StatusCode = 408
+	StatusConflict                      StatusCode = 409
+	StatusGone                          StatusCode = 410
+	StatusLengthRequired                StatusCode = 411
+	StatusPreconditionFailed            StatusCode = 412
+	StatusContentTooLarge               StatusCode = 413
+	StatusURITooLong                    StatusCode = 414
+	StatusUnsupportedMediaType          StatusCode = 415
+	StatusRangeNotSatisfiable           StatusCode = 416
+	StatusExpectationFailed             StatusCode = 417
+	StatusMisdirectedRequest            StatusCode = 421
+	StatusUnprocessableContent          StatusCode = 422
+	StatusUpgradeRequired               StatusCode = 426
+	StatusPreconditionRequired          StatusCode = 428 // RFC 6585
+	StatusTooManyRequests               StatusCode = 429 // RFC 6585
+	StatusRequestHeaderFieldsTooLarge   StatusCode = 431 // RFC 6585
+	StatusUnavailableForLegalReasons    StatusCode = 451 // RFC 7725
+	StatusInternalServerError           StatusCode = 500
+	StatusNotImplemented                StatusCode = 501
+	StatusBadGateway                    StatusCode = 502
+	StatusServiceUnavailable            StatusCode = 503
+	StatusGatewayTimeout                StatusCode = 504
+	StatusHTTPVersionNotSupported       StatusCode = 505
+	StatusNetworkAuthenticationRequired StatusCode = 511 // RFC 6585
+)
+
+var statusText = map[StatusCode]string{
+	StatusContinue:           "Continue",
+	StatusSwitchingProtocols: "Switching Protocols",
+	StatusEarlyHints:         "Early Hints",
+
+	StatusOK:                   "OK",
+	StatusCreated:              "Created",
+	StatusAccepted:             "Accepted",
+	StatusNonAuthoritativeInfo: "Non-Authoritative Information",
+	StatusNoContent:            "No Content",
+	StatusResetContent:         "Reset Content",
+	StatusPartialContent:       "Partial Content",
+
+	StatusMultipleChoices:   "Multiple Choices",
+	StatusMovedPermanently:  "Moved Permanently",
+	StatusFound:             "Found",
+	StatusSeeOther:          "See Other",
+	StatusNotModified:       "Not Modified",
+	StatusUseProxy:          "Use Proxy",
+	StatusTemporaryRedirect: "Temporary Redirect",
+	StatusPermanentRedirect: "Permanent Redirect",
+
+	StatusBadRequest:                  "Bad Request",
+	StatusUnauthorized:                "Unauthorized",
+	StatusPaymentRequired:             "Payment Required",
+	StatusForbidden:                   "Forbidden",
+	StatusNotFound:                    "Not Found",
+	StatusMethodNotAllowed:            "Method Not Allowed",
+	StatusNotAcceptable:               "Not Acceptable",
+	StatusProxyAuthRequired:           "Proxy Authentication Required",
+	StatusRequestTimeout:              "Request Timeout",
+	StatusConflict:                    "Conflict",
+	StatusGone:                        "Gone",
+	StatusLengthRequired:              "Length Required",
+	StatusPreconditionFailed:          "Precondition Failed",
+	StatusContentTooLarge:             "Content Too Large",
+	StatusURITooLong:                  "URI Too Long",
+	StatusUnsupportedMediaType:        "Unsupported Media Type",
+	StatusRangeNotSatisfiable:         "Range Not Satisfiable",
+	StatusExpectationFailed:           "Expectation Failed",
+	StatusMisdirectedRequest:          "Misdirected Request",
+	StatusUnprocessableContent:        "Unprocessable Content",
+	StatusUpgradeRequired:             "Upgrade Required",
+	StatusPreconditionRequired:        "Precondition Required",
+	StatusTooManyRequests:             "Too Many Requests",
+	StatusRequestHeaderFieldsTooLarge: "Request Header Fields Too Large",
+	StatusUnavailableForLegalReasons:  "Unavailable For Legal Reasons",
+
+	StatusInternalServerError:           "Internal Server Error",
+	StatusNotImplemented:                "Not Implemented",
+	StatusBadGateway:                    "Bad Gateway",
+	StatusServiceUnavailable:            "Service Unavailable",
+	StatusGatewayTimeout:                "Gateway Timeout",
+	StatusHTTPVersionNotSupported:       "HTTP Version Not Supported",
+	StatusNetworkAuthenticationRequired: "Network Authentication Required",
+}
+
+// Text returns the standard reason phrase of the status code,
+// or "" if the code is unknown
+func (s StatusCode) Text() string {
+	return statusText[s]
+}
+
+// IsValid reports whether the status code has the three digits
+// required in a status line
+func (s StatusCode) IsValid() bool {
+	return s >= 100 && s <= 999
+}
+
+// validReasonPhrase reports whether reason can be sent in a status line:
+// reason-phrase = 1*( HTAB / SP / VCHAR / obs-text )
+func validReasonPhrase(reason string) bool {
+	for i := 0; i < len(reason); i++ {
+		c := reason[i]
+		if c != '\t' && (c < ' ' || c == 0x7f) {
+			return false
+		}
+	}
+	return true
+}
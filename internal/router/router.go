@@ -0,0 +1,273 @@
+package router
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/agustin-carnevale/tcp-to-http/internal/request"
+	"github.com/agustin-carnevale/tcp-to-http/internal/response"
+	"github.com/agustin-carnevale/tcp-to-http/internal/server"
+)
+
+// Router dispatches requests to handlers registered by method and path pattern.
+// A pattern is a path where a segment can be:
+//   - a literal, e.g. /users
+//   - a parameter matching exactly one segment, e.g. /users/{id}
+//   - a wildcard matching the rest of the path (last segment only), e.g. /static/*path
+//
+// Literals win over parameters, and parameters over wildcards.
+// Captured values are available with req.PathParam(name).
+//
+// Requests matching no pattern get a 404, the ones matching a pattern
+// registered for other methods get a 405 with the Allow header. HEAD requests
+// go to the GET handler when there is no HEAD one (the body is not sent).
+// Router.Serve is a server.Handler.
+type Router struct {
+	root *node
+	// every method with a handler, to tell unknown methods
+	// (501) from the ones not allowed for a path (405)
+	methods map[string]struct{}
+	// NotFound, if set, handles the requests matching no pattern
+	NotFound server.Handler
+}
+
+type node struct {
+	// children by literal segment
+	static map[string]*node
+	// {name} child
+	param     *node
+	paramName string
+	// *name child, always a leaf
+	wildcard     *node
+	wildcardName string
+	// handlers by method, for patterns ending at this node
+	handlers map[string]server.Handler
+}
+
+func New() *Router {
+	return &Router{
+		root:    &node{},
+		methods: map[string]struct{}{},
+	}
+}
+
+// Handle registers handler for requests with the given method and path pattern.
+// It panics if the pattern is invalid or already registered for that method.
+func (rt *Router) Handle(method, pattern string, handler server.Handler) {
+	if !strings.HasPrefix(pattern, "/") {
+		panic(fmt.Sprintf("router: pattern must start with '/': %q", pattern))
+	}
+
+	n := rt.root
+	segments := splitPath(pattern)
+	for i, segment := range segments {
+		switch {
+		case strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}"):
+			name := segment[1 : len(segment)-1]
+			if name == "" {
+				panic(fmt.Sprintf("router: empty parameter name in %q", pattern))
+			}
+			if n.param == nil {
+				n.param = &node{}
+				n.paramName = name
+			} else if n.paramName != name {
+				panic(fmt.Sprintf("router: parameter {%s} in %q conflicts with {%s}", name, pattern, n.paramName))
+			}
+			n = n.param
+
+		case strings.HasPrefix(segment, "*"):
+			name := segment[1:]
+			if name == "" {
+				panic(fmt.Sprintf("router: empty wildcard name in %q", pattern))
+			}
+			if i != len(segments)-1 {
+				panic(fmt.Sprintf("router: wildcard must be the last segment in %q", pattern))
+			}
+			if n.wildcard == nil {
+				n.wildcard = &node{}
+				n.wildcardName = name
+			} else if n.wildcardName != name {
+				panic(fmt.Sprintf("router: wildcard *%s in %q conflicts with *%s", name, pattern, n.wildcardName))
+			}
+			n = n.wildcard
+
+		default:
+			if n.static == nil {
+				n.static = map[string]*node{}
+			}
+			child, exists := n.static[segment]
+			if !exists {
+				child = &node{}
+				n.static[segment] = child
+			}
+			n = child
+		}
+	}
+
+	if n.handlers == nil {
+		n.handlers = map[string]server.Handler{}
+	}
+	rt.methods[method] = struct{}{}
+	if _, exists := n.handlers[method]; exists {
+		panic(fmt.Sprintf("router: %s %s registered twice", method, pattern))
+	}
+	n.handlers[method] = handler
+}
+
+func (rt *Router) Get(pattern string, handler server.Handler) {
+	rt.Handle("GET", pattern, handler)
+}
+
+func (rt *Router) Post(pattern string, handler server.Handler) {
+	rt.Handle("POST", pattern, handler)
+}
+
+// Serve dispatches the request to the matching handler
+func (rt *Router) Serve(w *response.Writer, req *request.Request) {
+	// decoded and cleaned, absolute-form targets (sent to proxies) are routed
+	// by their path too, authority and asterisk forms have none
+	path := req.Path()
+	if path == "" {
+		rt.notFound(w, req)
+		return
+	}
+
+	segments := splitPath(path)
+	method := req.RequestLine.Method
+
+	params := map[string]string{}
+	n := rt.root.match(segments, params, func(n *node) bool {
+		return n.handler(method) != nil
+	})
+	if n != nil {
+		req.PathParams = params
+		n.handler(method)(w, req)
+		return
+	}
+
+	if !rt.knownMethod(method) {
+		// no handler for this method anywhere
+		writeError(w, response.StatusNotImplemented, "Not Implemented", "")
+		return
+	}
+
+	// no handler for this method here, is the path known at all?
+	n = rt.root.match(segments, map[string]string{}, func(n *node) bool {
+		return len(n.handlers) > 0
+	})
+	if n != nil {
+		writeError(w, response.StatusMethodNotAllowed, "Method Not Allowed", allowedMethods(n.handlers))
+		return
+	}
+
+	rt.notFound(w, req)
+}
+
+// knownMethod reports whether some pattern has a handler for method
+func (rt *Router) knownMethod(method string) bool {
+	if _, known := rt.methods[method]; known {
+		return true
+	}
+	_, known := rt.methods["GET"]
+	return method == "HEAD" && known
+}
+
+func (rt *Router) notFound(w *response.Writer, req *request.Request) {
+	if rt.NotFound != nil {
+		rt.NotFound(w, req)
+		return
+	}
+	writeError(w, response.StatusNotFound, "Not Found", "")
+}
+
+// handler returns the handler of the node for method, or nil if it has none.
+// Without a HEAD handler, HEAD is handled by the GET one.
+func (n *node) handler(method string) server.Handler {
+	if handler, exists := n.handlers[method]; exists {
+		return handler
+	}
+	if method == "HEAD" {
+		return n.handlers["GET"]
+	}
+	return nil
+}
+
+// match finds the node for the given path segments accepted by accept,
+// filling params on the way. It backtracks so a literal that leads nowhere
+// doesn't hide a parameter (or wildcard) match.
+func (n *node) match(segments []string, params map[string]string, accept func(*node) bool) *node {
+	if len(segments) == 0 {
+		if accept(n) {
+			return n
+		}
+		// a wildcard also matches an empty rest of path
+		if n.wildcard != nil && accept(n.wildcard) {
+			params[n.wildcardName] = ""
+			return n.wildcard
+		}
+		return nil
+	}
+
+	segment := segments[0]
+	if child, exists := n.static[segment]; exists {
+		if found := child.match(segments[1:], params, accept); found != nil {
+			return found
+		}
+	}
+
+	if n.param != nil && segment != "" {
+		if found := n.param.match(segments[1:], params, accept); found != nil {
+			params[n.paramName] = segment
+			return found
+		}
+	}
+
+	if n.wildcard != nil && accept(n.wildcard) {
+		params[n.wildcardName] = strings.Join(segments, "/")
+		return n.wildcard
+	}
+
+	return nil
+}
+
+// splitPath returns the segments of a path, "/" having none
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+func allowedMethods(handlers map[string]server.Handler) string {
+	methods := make([]string, 0, len(handlers))
+	for method := range handlers {
+		methods = append(methods, method)
+	}
+	_, hasGet := handlers["GET"]
+	if _, hasHead := handlers["HEAD"]; hasGet && !hasHead {
+		methods = append(methods, "HEAD")
+	}
+	sort.Strings(methods)
+	return strings.Join(methods, ", ")
+}
+
+// writeError writes a plain text error response, with the Allow header if given
+func writeError(w *response.Writer, statusCode response.StatusCode, message string, allow string) {
+	err := w.WriteStatusLine(statusCode)
+	if err != nil {
+		return
+	}
+
+	headers := response.GetDefaultHeaders(len(message))
+	if allow != "" {
+		headers.Set("Allow", allow)
+	}
+	err = w.WriteHeaders(headers, false)
+	if err != nil {
+		return
+	}
+
+	w.WriteBody([]byte(message))
+}
@@ -0,0 +1,128 @@
+package router
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/agustin-carnevale/tcp-to-http/internal/request"
+	"github.com/agustin-carnevale/tcp-to-http/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serve runs the router on the given raw request and returns the response
+func serve(t *testing.T, rt *Router, rawRequest string) (*http.Response, string) {
+	t.Helper()
+	req, err := request.RequestFromReader(strings.NewReader(rawRequest))
+	require.NoError(t, err)
+
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	go func() {
+		defer serverConn.Close()
+		rt.Serve(&response.Writer{Connection: serverConn, Method: req.RequestLine.Method}, req)
+	}()
+
+	resp, err := http.ReadResponse(bufio.NewReader(clientConn), &http.Request{Method: req.RequestLine.Method})
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, string(body)
+}
+
+// text returns a handler answering 200 with the result of f
+func text(f func(req *request.Request) string) func(w *response.Writer, req *request.Request) {
+	return func(w *response.Writer, req *request.Request) {
+		body := f(req)
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)), false)
+		w.WriteBody([]byte(body))
+	}
+}
+
+func TestRouter(t *testing.T) {
+	rt := New()
+	rt.Get("/", text(func(req *request.Request) string { return "root" }))
+	rt.Get("/users/me", text(func(req *request.Request) string { return "me" }))
+	rt.Get("/users/{id}", text(func(req *request.Request) string { return "user " + req.PathParam("id") }))
+	rt.Post("/users/{id}", text(func(req *request.Request) string { return "update " + req.PathParam("id") }))
+	rt.Get("/users/{id}/posts/{post}", text(func(req *request.Request) string {
+		return req.PathParam("id") + "/" + req.PathParam("post")
+	}))
+	rt.Handle("DELETE", "/users/me", text(func(req *request.Request) string { return "deleted" }))
+	rt.Get("/static/*path", text(func(req *request.Request) string { return "file " + req.PathParam("path") }))
+
+	tests := []struct {
+		request    string
+		statusCode int
+		body       string
+	}{
+		{"GET / HTTP/1.1\r\n\r\n", 200, "root"},
+		// literals win over parameters
+		{"GET /users/me HTTP/1.1\r\n\r\n", 200, "me"},
+		{"GET /users/42 HTTP/1.1\r\n\r\n", 200, "user 42"},
+		// the query is not part of the path
+		{"GET /users/42?full=true HTTP/1.1\r\n\r\n", 200, "user 42"},
+		// a parameter route handles the method the literal one doesn't
+		{"POST /users/me HTTP/1.1\r\n\r\n", 200, "update me"},
+		{"GET /users/42/posts/7 HTTP/1.1\r\n\r\n", 200, "42/7"},
+		{"GET /static/css/main.css HTTP/1.1\r\n\r\n", 200, "file css/main.css"},
+		{"GET /static HTTP/1.1\r\n\r\n", 200, "file "},
+		{"GET /nope HTTP/1.1\r\n\r\n", 404, "Not Found"},
+		{"GET /users/42/comments HTTP/1.1\r\n\r\n", 404, "Not Found"},
+		{"DELETE /users/42 HTTP/1.1\r\n\r\n", 405, "Method Not Allowed"},
+		// HEAD is handled by GET, without the body
+		{"HEAD /users/42 HTTP/1.1\r\n\r\n", 200, ""},
+		{"HEAD /nope HTTP/1.1\r\n\r\n", 404, ""},
+		// methods with no handler at all
+		{"PUT /users/42 HTTP/1.1\r\n\r\n", 501, "Not Implemented"},
+		{"PROPFIND /nope HTTP/1.1\r\n\r\n", 501, "Not Implemented"},
+		// proxy-style targets are routed by their path
+		{"GET http://example.com/users/42?full=true HTTP/1.1\r\n\r\n", 200, "user 42"},
+		{"GET http://example.com HTTP/1.1\r\n\r\n", 200, "root"},
+		// paths are decoded and cleaned before routing
+		{"GET /users/john%20doe HTTP/1.1\r\n\r\n", 200, "user john doe"},
+		{"GET /static/../users//42/ HTTP/1.1\r\n\r\n", 200, "user 42"},
+		// targets without a path never match
+		{"OPTIONS * HTTP/1.1\r\n\r\n", 404, "Not Found"},
+	}
+	for _, tt := range tests {
+		resp, body := serve(t, rt, tt.request)
+		assert.Equal(t, tt.statusCode, resp.StatusCode, tt.request)
+		assert.Equal(t, tt.body, body, tt.request)
+	}
+
+	// Test: 405 lists the allowed methods
+	resp, _ := serve(t, rt, "DELETE /users/42 HTTP/1.1\r\n\r\n")
+	assert.Equal(t, "GET, HEAD, POST", resp.Header.Get("Allow"))
+
+	// Test: HEAD gets the headers of GET
+	resp, _ = serve(t, rt, "HEAD /users/42 HTTP/1.1\r\n\r\n")
+	assert.Equal(t, int64(len("user 42")), resp.ContentLength)
+
+	// Test: A HEAD handler wins over GET
+	rt.Handle("HEAD", "/users/me", text(func(req *request.Request) string { return "head me" }))
+	resp, _ = serve(t, rt, "HEAD /users/me HTTP/1.1\r\n\r\n")
+	assert.Equal(t, int64(len("head me")), resp.ContentLength)
+
+	// Test: Custom not found handler
+	rt.NotFound = text(func(req *request.Request) string { return "custom" })
+	resp, body := serve(t, rt, "GET /nope HTTP/1.1\r\n\r\n")
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "custom", body)
+}
+
+func TestRouterInvalidPatterns(t *testing.T) {
+	rt := New()
+	rt.Get("/users/{id}", text(func(req *request.Request) string { return "" }))
+
+	assert.Panics(t, func() { rt.Get("users", nil) })
+	assert.Panics(t, func() { rt.Get("/users/{}", nil) })
+	assert.Panics(t, func() { rt.Get("/users/{name}/posts", nil) })
+	assert.Panics(t, func() { rt.Get("/static/*path/more", nil) })
+	assert.Panics(t, func() { rt.Get("/users/{id}", nil) })
+}
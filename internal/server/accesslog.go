@@ -0,0 +1,139 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/agustin-carnevale/tcp-to-http/internal/request"
+	"github.com/agustin-carnevale/tcp-to-http/internal/response"
+)
+
+// AccessLogEntry is what the access log records about each request served
+type AccessLogEntry struct {
+	Time       time.Time
+	RemoteAddr string
+	Method     string
+	Target     string
+	Protocol   string
+	StatusCode response.StatusCode
+	// BytesWritten is the size of the response body
+	BytesWritten int
+	Duration     time.Duration
+	UserAgent    string
+	Referer      string
+}
+
+// AccessLogFormat turns an entry into a single log line (without the newline)
+type AccessLogFormat func(entry AccessLogEntry) string
+
+// CombinedLogFormat is the Apache combined log format:
+//
+//	127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET / HTTP/1.1" 200 2326 "http://example.com/" "curl/7.81.0"
+func CombinedLogFormat(entry AccessLogEntry) string {
+	host, _, err := net.SplitHostPort(entry.RemoteAddr)
+	if err != nil {
+		host = entry.RemoteAddr
+	}
+
+	bytes := "-"
+	if entry.BytesWritten > 0 {
+		bytes = strconv.Itoa(entry.BytesWritten)
+	}
+
+	return fmt.Sprintf("%s - - [%s] \"%s %s %s\" %d %s \"%s\" \"%s\"",
+		orDash(host),
+		entry.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		orDash(entry.Method),
+		orDash(escapeQuotes(entry.Target)),
+		orDash(entry.Protocol),
+		entry.StatusCode,
+		bytes,
+		orDash(escapeQuotes(entry.Referer)),
+		orDash(escapeQuotes(entry.UserAgent)),
+	)
+}
+
+// JSONLogFormat writes each entry as a JSON object (JSON lines)
+func JSONLogFormat(entry AccessLogEntry) string {
+	line, err := json.Marshal(struct {
+		Time       string  `json:"time"`
+		RemoteAddr string  `json:"remote_addr"`
+		Method     string  `json:"method"`
+		Target     string  `json:"target"`
+		Protocol   string  `json:"protocol"`
+		Status     int     `json:"status"`
+		Bytes      int     `json:"bytes"`
+		DurationMs float64 `json:"duration_ms"`
+		UserAgent  string  `json:"user_agent"`
+		Referer    string  `json:"referer"`
+	}{
+		Time:       entry.Time.Format(time.RFC3339Nano),
+		RemoteAddr: entry.RemoteAddr,
+		Method:     entry.Method,
+		Target:     entry.Target,
+		Protocol:   entry.Protocol,
+		Status:     int(entry.StatusCode),
+		Bytes:      entry.BytesWritten,
+		DurationMs: float64(entry.Duration) / float64(time.Millisecond),
+		UserAgent:  entry.UserAgent,
+		Referer:    entry.Referer,
+	})
+	if err != nil {
+		// can't happen with strings and numbers only
+		return "{}"
+	}
+	return string(line)
+}
+
+// logAccess writes the access log entry of a request (if the log is enabled).
+// req is nil when the request couldn't be parsed.
+func (s *Server) logAccess(conn net.Conn, req *request.Request, w *response.Writer, start time.Time) {
+	if s.config.AccessLog == nil {
+		return
+	}
+
+	entry := AccessLogEntry{
+		Time:         start,
+		RemoteAddr:   conn.RemoteAddr().String(),
+		StatusCode:   w.StatusCode(),
+		BytesWritten: w.BytesWritten(),
+		Duration:     time.Since(start),
+	}
+	if req != nil {
+		entry.Method = req.RequestLine.Method
+		entry.Target = req.RequestLine.RequestTarget
+		entry.Protocol = "HTTP/" + req.RequestLine.HttpVersion
+		entry.UserAgent, _ = req.Headers.Get("User-Agent")
+		entry.Referer, _ = req.Headers.Get("Referer")
+	}
+
+	format := s.config.AccessLogFormat
+	if format == nil {
+		format = CombinedLogFormat
+	}
+	line := format(entry) + "\n"
+
+	// one line at a time, connections are served concurrently
+	s.accessLogMu.Lock()
+	defer s.accessLogMu.Unlock()
+	s.config.AccessLog.Write([]byte(line))
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+var quoteEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// escapeQuotes escapes a value written between quotes the way Apache does,
+// so a quote in it can't end the field (and fake the rest of the line)
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/agustin-carnevale/tcp-to-http/internal/request"
+	"github.com/agustin-carnevale/tcp-to-http/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lineWriter hands every line written to it to the test
+type lineWriter chan string
+
+func (lw lineWriter) Write(p []byte) (int, error) {
+	lw <- string(p)
+	return len(p), nil
+}
+
+func TestCombinedLogFormat(t *testing.T) {
+	entry := AccessLogEntry{
+		Time:         time.Date(2000, time.October, 10, 13, 55, 36, 0, time.FixedZone("", -7*60*60)),
+		RemoteAddr:   "127.0.0.1:51234",
+		Method:       "GET",
+		Target:       "/apache_pb.gif",
+		Protocol:     "HTTP/1.1",
+		StatusCode:   200,
+		BytesWritten: 2326,
+		UserAgent:    "curl/7.81.0",
+		Referer:      "http://www.example.com/start.html",
+	}
+	assert.Equal(t,
+		`127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.1" 200 2326 "http://www.example.com/start.html" "curl/7.81.0"`,
+		CombinedLogFormat(entry))
+
+	// Test: Quotes and backslashes are escaped inside quoted fields
+	entry.Target = `/a"b\c`
+	entry.UserAgent = `agent\" "x`
+	assert.Equal(t,
+		`127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /a\"b\\c HTTP/1.1" 200 2326 "http://www.example.com/start.html" "agent\\\" \"x"`,
+		CombinedLogFormat(entry))
+
+	// Test: Missing values are dashes
+	entry = AccessLogEntry{Time: entry.Time, RemoteAddr: "127.0.0.1:51234", StatusCode: 400}
+	assert.Equal(t, `127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "- - -" 400 - "-" "-"`, CombinedLogFormat(entry))
+}
+
+func TestServerAccessLog(t *testing.T) {
+	lines := make(lineWriter, 10)
+	_, addr := startServer(t, func(w *response.Writer, req *request.Request) {
+		writeText(w, response.StatusCreated, "hello")
+	}, Config{AccessLog: lines, AccessLogFormat: JSONLogFormat})
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "POST /items?x=1 HTTP/1.1\r\nHost: localhost\r\nUser-Agent: test-agent\r\nReferer: http://localhost/\r\n\r\n")
+	require.NoError(t, err)
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	io.ReadAll(resp.Body)
+
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal([]byte(<-lines), &entry))
+	assert.Equal(t, conn.LocalAddr().String(), entry["remote_addr"])
+	assert.Equal(t, "POST", entry["method"])
+	assert.Equal(t, "/items?x=1", entry["target"])
+	assert.Equal(t, "HTTP/1.1", entry["protocol"])
+	assert.Equal(t, float64(201), entry["status"])
+	assert.Equal(t, float64(5), entry["bytes"])
+	assert.Equal(t, "test-agent", entry["user_agent"])
+	assert.Equal(t, "http://localhost/", entry["referer"])
+
+	// Test: Requests that can't be parsed are logged too
+	conn, err = net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost localhost\r\n\r\n")
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal([]byte(<-lines), &entry))
+	assert.Equal(t, float64(400), entry["status"])
+}
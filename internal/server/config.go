@@ -0,0 +1,104 @@
+package server
+
+import (
+	"io"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/agustin-carnevale/tcp-to-http/internal/request"
+)
+
+// Config holds the optional settings of a Server.
+// The zero value means no timeouts at all and the default request limits.
+type Config struct {
+	// ReadHeaderTimeout is the time allowed to read the request-line and
+	// headers of a request. A client that doesn't send them in time gets
+	// a 408 Request Timeout. If zero, ReadTimeout is used.
+	ReadHeaderTimeout time.Duration
+	// ReadTimeout is the time allowed to read an entire request, body
+	// included, counted from the moment the request starts arriving.
+	ReadTimeout time.Duration
+	// WriteTimeout is the time allowed to write the response,
+	// counted from the end of the request headers.
+	WriteTimeout time.Duration
+	// IdleTimeout is the time a keep-alive connection can wait for the
+	// next request before being closed. If zero, ReadTimeout is used.
+	IdleTimeout time.Duration
+
+	// MaxRequestLineBytes is the max length of the request-line,
+	// longer ones get a 414 URI Too Long.
+	MaxRequestLineBytes int
+	// MaxHeaderBytes and MaxHeaderCount bound the header section,
+	// bigger ones get a 431 Request Header Fields Too Large.
+	MaxHeaderBytes int
+	MaxHeaderCount int
+	// MaxBodyBytes is the max size of a request body, bigger ones
+	// get a 413 Content Too Large. If zero, there is no limit.
+	MaxBodyBytes int
+
+	// LenientHeaders accepts header lines continued with obsolete line
+	// folding (unfolded into a single line), instead of answering 400.
+	// Only meant for old clients, folding is a way to smuggle fields.
+	LenientHeaders bool
+	// StrictPaths answers 400 to request paths with encoded dot segments or
+	// slashes ("/files/%2e%2e/secret"), instead of decoding and cleaning them.
+	StrictPaths bool
+
+	// AllowedMethods, if set, are the only request methods passed to the
+	// handler, others get a 501 Not Implemented. Any method is accepted
+	// by default.
+	AllowedMethods []string
+
+	// AccessLog, if set, gets a line for every request served,
+	// in AccessLogFormat (CombinedLogFormat by default).
+	AccessLog       io.Writer
+	AccessLogFormat AccessLogFormat
+
+	// Logger gets the server errors (bad requests, panics...),
+	// with the connection and request ids. If nil, slog.Default() is used.
+	Logger *slog.Logger
+}
+
+func (c Config) logger() *slog.Logger {
+	if c.Logger != nil {
+		return c.Logger
+	}
+	return slog.Default()
+}
+
+func (c Config) limits() request.Limits {
+	return request.Limits{
+		MaxRequestLineBytes: c.MaxRequestLineBytes,
+		MaxHeaderBytes:      c.MaxHeaderBytes,
+		MaxHeaderCount:      c.MaxHeaderCount,
+		MaxBodyBytes:        c.MaxBodyBytes,
+	}
+}
+
+func (c Config) readHeaderTimeout() time.Duration {
+	if c.ReadHeaderTimeout > 0 {
+		return c.ReadHeaderTimeout
+	}
+	return c.ReadTimeout
+}
+
+func (c Config) idleTimeout() time.Duration {
+	if c.IdleTimeout > 0 {
+		return c.IdleTimeout
+	}
+	return c.ReadTimeout
+}
+
+// deadline returns the time after timeout from start,
+// or the zero time (no deadline) if timeout is not set
+func deadline(start time.Time, timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return start.Add(timeout)
+}
+
+func (c Config) methodAllowed(method string) bool {
+	return len(c.AllowedMethods) == 0 || slices.Contains(c.AllowedMethods, method)
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"errors"
+	"io"
+
+	"github.com/agustin-carnevale/tcp-to-http/internal/response"
+)
+
+// expectContinueBody sends the 100 Continue the client is waiting for
+// the first time the handler reads the body. A handler that answers
+// without reading never asks for the body.
+type expectContinueBody struct {
+	body io.ReadCloser
+	w    *response.Writer
+	sent bool
+}
+
+func (b *expectContinueBody) Read(p []byte) (int, error) {
+	if !b.sent {
+		b.sent = true
+		if b.w.State() == response.WriteStatusLine {
+			if err := b.w.WriteInformational(response.StatusContinue, nil); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return b.body.Read(p)
+}
+
+// Close fails if the body was never asked for: the client may or may not
+// send it after the final response, so the connection can't be reused.
+func (b *expectContinueBody) Close() error {
+	if !b.sent {
+		return errors.New("body of 100-continue request not read")
+	}
+	return b.body.Close()
+}
@@ -8,29 +8,37 @@ import (
 type HandlerError struct {
 	StatusCode response.StatusCode
 	Message    string
+	// KeepAlive leaves the connection open after the response, for errors
+	// that don't come from a broken request (e.g. a 404)
+	KeepAlive bool
 }
 
 type Handler func(w *response.Writer, req *request.Request)
 
-// func (h *HandlerError) WriteErrorResponse(w io.Writer) error {
-
-// 	err := response.WriteStatusLine(w, h.StatusCode)
-// 	if err != nil {
-// 		return err
-// 	}
-
-// 	contentLength := len(h.Message)
-// 	headers := response.GetDefaultHeaders(contentLength)
-// 	err = response.WriteHeaders(w, headers)
-// 	if err != nil {
-// 		return err
-// 	}
-
-// 	// response body
-// 	_, err = w.Write([]byte(h.Message))
-// 	if err != nil {
-// 		return err
-// 	}
-
-// 	return nil
-// }
+// WriteErrorResponse writes a plain text response with the error status code
+// and message. The connection is closed after an error response, unless
+// KeepAlive is set.
+func (h *HandlerError) WriteErrorResponse(w *response.Writer) error {
+	err := w.WriteStatusLine(h.StatusCode)
+	if err != nil {
+		return err
+	}
+
+	contentLength := len(h.Message)
+	headers := response.GetDefaultHeaders(contentLength)
+	if !h.KeepAlive {
+		headers.Set("Connection", "close")
+	}
+	err = w.WriteHeaders(headers, false)
+	if err != nil {
+		return err
+	}
+
+	// response body
+	_, err = w.WriteBody([]byte(h.Message))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
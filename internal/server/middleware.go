@@ -0,0 +1,17 @@
+package server
+
+// Middleware wraps a Handler to add behavior around it (logging, auth,
+// metrics...). After calling the next handler, a middleware can look at
+// what was sent with w.StatusCode() and w.BytesWritten().
+type Middleware func(Handler) Handler
+
+// Chain wraps handler with the given middlewares. The first middleware
+// is the outermost one, so it sees the request first and the response last:
+//
+//	Chain(h, logging, auth) == logging(auth(h))
+func Chain(handler Handler, middlewares ...Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/agustin-carnevale/tcp-to-http/internal/headers"
+	"github.com/agustin-carnevale/tcp-to-http/internal/request"
+	"github.com/agustin-carnevale/tcp-to-http/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChain(t *testing.T) {
+	calls := []string{}
+	var statusCode response.StatusCode
+	var bytesWritten int
+	done := make(chan struct{})
+
+	trace := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(w *response.Writer, req *request.Request) {
+				calls = append(calls, name+" before")
+				next(w, req)
+				calls = append(calls, name+" after")
+			}
+		}
+	}
+	observe := func(next Handler) Handler {
+		return func(w *response.Writer, req *request.Request) {
+			next(w, req)
+			statusCode = w.StatusCode()
+			bytesWritten = w.BytesWritten()
+			close(done)
+		}
+	}
+
+	handler := Chain(func(w *response.Writer, req *request.Request) {
+		calls = append(calls, "handler")
+		writeText(w, response.StatusNotFound, "nothing here")
+	}, observe, trace("first"), trace("second"))
+
+	_, addr := startServer(t, handler, Config{})
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	require.NoError(t, err)
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	io.ReadAll(resp.Body)
+	<-done
+
+	// Test: First middleware is the outermost
+	assert.Equal(t, []string{"first before", "second before", "handler", "second after", "first after"}, calls)
+
+	// Test: Middleware observes status and body size
+	assert.Equal(t, response.StatusNotFound, statusCode)
+	assert.Equal(t, len("nothing here"), bytesWritten)
+}
+
+func TestMiddlewareBufferedResponse(t *testing.T) {
+	bytesWritten := make(chan int, 1)
+	observe := func(next Handler) Handler {
+		return func(w *response.Writer, req *request.Request) {
+			next(w, req)
+			bytesWritten <- w.BytesWritten()
+		}
+	}
+
+	// Test: A body without Content-Length, still buffered, is counted
+	handler := Chain(func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(headers.NewHeaders(), false)
+		io.WriteString(w, "hello")
+	}, observe)
+
+	_, addr := startServer(t, handler, Config{})
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	require.NoError(t, err)
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+	assert.Equal(t, len("hello"), <-bytesWritten)
+}
@@ -1,22 +1,45 @@
 package server
 
 import (
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"net"
+	"os"
+	"runtime/debug"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/agustin-carnevale/tcp-to-http/internal/request"
 	"github.com/agustin-carnevale/tcp-to-http/internal/response"
 )
 
+// Request bodies up to this size are read before calling the handler and
+// available in req.Body, bigger ones are streamed through req.BodyReader
+const maxBufferedBodySize = 64 * 1024
+
 type Server struct {
 	Listener net.Listener
 	handler  Handler
+	config   Config
 	closed   atomic.Bool
+	// to tell connections apart in the logs
+	lastConnID atomic.Uint64
+
+	// open connections and their state, for Shutdown
+	mu    sync.Mutex
+	conns map[net.Conn]connState
+
+	accessLogMu sync.Mutex
 }
 
 func Serve(port int, handler Handler) (*Server, error) {
+	return ServeWithConfig(port, handler, Config{})
+}
+
+func ServeWithConfig(port int, handler Handler, config Config) (*Server, error) {
 	addr := fmt.Sprintf(":%d", port)
 	listener, err := net.Listen("tcp", addr)
 	if err != nil {
@@ -26,6 +49,7 @@ func Serve(port int, handler Handler) (*Server, error) {
 	server := Server{
 		Listener: listener,
 		handler:  handler,
+		config:   config,
 	}
 
 	go server.listen()
@@ -48,27 +72,209 @@ func (s *Server) listen() {
 			if s.closed.Load() {
 				return
 			}
-			fmt.Println("Error while accepting tcp connection:", err)
+			s.config.logger().Error("Error while accepting tcp connection", "error", err)
 			continue
 		}
+		if !s.trackConn(conn) {
+			conn.Close()
+			return
+		}
 		go s.handle(conn)
 	}
 }
 
+// requestErrorResponse returns the error response to send when reading a
+// request failed, or nil if there is no response for that error
+// (e.g. the client is gone)
+func requestErrorResponse(err error) *HandlerError {
+	switch {
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		return &HandlerError{StatusCode: response.StatusRequestTimeout, Message: "Request Timeout"}
+	case errors.Is(err, request.ErrRequestLineTooLong):
+		return &HandlerError{StatusCode: response.StatusURITooLong, Message: "URI Too Long"}
+	case errors.Is(err, request.ErrHeaderFieldsTooLarge):
+		return &HandlerError{StatusCode: response.StatusRequestHeaderFieldsTooLarge, Message: "Request Header Fields Too Large"}
+	case errors.Is(err, request.ErrBodyTooLarge):
+		return &HandlerError{StatusCode: response.StatusContentTooLarge, Message: "Content Too Large"}
+	case errors.Is(err, request.ErrUnsupportedVersion):
+		return &HandlerError{StatusCode: response.StatusHTTPVersionNotSupported, Message: "HTTP Version Not Supported"}
+	case errors.Is(err, request.ErrUnsupportedTransferEncoding):
+		return &HandlerError{StatusCode: response.StatusNotImplemented, Message: "Not Implemented"}
+	case errors.Is(err, request.ErrMalformedRequestLine),
+		errors.Is(err, request.ErrInvalidMethod),
+		errors.Is(err, request.ErrInvalidTarget),
+		errors.Is(err, request.ErrMalformedHeader),
+		errors.Is(err, request.ErrInvalidContentLength),
+		errors.Is(err, request.ErrInvalidChunk),
+		errors.Is(err, request.ErrInvalidTrailer),
+		errors.Is(err, request.ErrBodyTooShort),
+		errors.Is(err, request.ErrInvalidHost):
+		return &HandlerError{StatusCode: response.StatusBadRequest, Message: "Bad Request"}
+	default:
+		return nil
+	}
+}
+
+// handle serves every request sent over conn, one after the other,
+// until the client or the response asks to close the connection
 func (s *Server) handle(conn net.Conn) {
 	defer conn.Close()
+	defer s.untrackConn(conn)
 
-	// Request
-	req, err := request.RequestFromReader(conn)
-	if err != nil {
-		log.Fatalf("Error getting/parsing request: %v", err)
-		return
-	}
+	connID := s.lastConnID.Add(1)
+	logger := s.config.logger().With(
+		"conn_id", connID,
+		"remote_addr", conn.RemoteAddr().String(),
+	)
+
+	// keeps any pipelined bytes between requests
+	reader := request.NewReaderWithLimits(conn, s.config.limits())
+	reader.SetLogger(logger)
+	reader.SetLenientHeaders(s.config.LenientHeaders)
+	reader.SetStrictPaths(s.config.StrictPaths)
+
+	for requestNumber := 1; ; requestNumber++ {
+		firstRequest := requestNumber == 1
+		reqLogger := logger.With("request_id", fmt.Sprintf("%d-%d", connID, requestNumber))
 
-	// Response
-	respWriter := &response.Writer{
-		Connection: conn,
+		requestStart := time.Now()
+		if firstRequest {
+			// the header timeout starts counting as soon as the connection is open
+			conn.SetReadDeadline(deadline(requestStart, s.config.readHeaderTimeout()))
+		} else {
+			// keep-alive connection, wait for the next request
+			conn.SetReadDeadline(deadline(requestStart, s.config.idleTimeout()))
+		}
+
+		if err := reader.WaitForRequest(); err != nil {
+			// client closed the connection (or sent nothing in time)
+			return
+		}
+		// a request is arriving, from now on Shutdown waits for it
+		if !s.setConnState(conn, CONN_ACTIVE) {
+			return
+		}
+
+		// Request
+		if !firstRequest {
+			requestStart = time.Now()
+			conn.SetReadDeadline(deadline(requestStart, s.config.readHeaderTimeout()))
+		}
+
+		req, err := reader.ReadRequestHeaders()
+		if err == nil {
+			// the body is read within ReadTimeout, even the small ones
+			// buffered here, the handler streams the rest, and the
+			// response is written within WriteTimeout from now on
+			conn.SetReadDeadline(deadline(requestStart, s.config.ReadTimeout))
+			conn.SetWriteDeadline(deadline(time.Now(), s.config.WriteTimeout))
+			err = reader.BufferBody(req, maxBufferedBodySize)
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				// client closed the connection, no more requests
+				return
+			}
+			// a bad request only costs its own connection
+			reqLogger.Warn("Error getting/parsing request", "error", err)
+			if handlerErr := requestErrorResponse(err); handlerErr != nil {
+				conn.SetWriteDeadline(deadline(time.Now(), s.config.WriteTimeout))
+				errWriter := &response.Writer{Connection: conn}
+				handlerErr.WriteErrorResponse(errWriter)
+				s.logAccess(conn, nil, errWriter, requestStart)
+			}
+			return
+		}
+
+		// Response
+		respWriter := &response.Writer{
+			Connection: conn,
+			Version:    req.RequestLine.HttpVersion,
+			Method:     req.RequestLine.Method,
+		}
+
+		if err := req.CheckHost(); err != nil {
+			reqLogger.Warn("Invalid request", "error", err)
+			requestErrorResponse(err).WriteErrorResponse(respWriter)
+			s.logAccess(conn, req, respWriter, requestStart)
+			return
+		}
+
+		if !s.config.methodAllowed(req.RequestLine.Method) {
+			handlerErr := &HandlerError{StatusCode: response.StatusNotImplemented, Message: "Not Implemented"}
+			handlerErr.WriteErrorResponse(respWriter)
+			s.logAccess(conn, req, respWriter, requestStart)
+			return
+		}
+
+		// HTTP/1.0 had no expectations, the field is ignored
+		if _, exists := req.Headers.Get("Expect"); exists && req.RequestLine.HttpVersion != "1.0" {
+			if !req.ExpectsContinue() {
+				// the only expectation defined is 100-continue
+				handlerErr := &HandlerError{StatusCode: response.StatusExpectationFailed, Message: "Expectation Failed"}
+				handlerErr.WriteErrorResponse(respWriter)
+				s.logAccess(conn, req, respWriter, requestStart)
+				return
+			}
+			if req.BodyPending() {
+				req.BodyReader = &expectContinueBody{body: req.BodyReader, w: respWriter}
+			}
+		}
+
+		ok := s.serveRequest(respWriter, req, reqLogger)
+		s.logAccess(conn, req, respWriter, requestStart)
+		if !ok {
+			// the handler panicked or didn't write the whole response
+			return
+		}
+
+		// discard whatever the handler didn't read from the body,
+		// if that's not possible the connection can't be reused
+		if err := req.BodyReader.Close(); err != nil {
+			return
+		}
+
+		if !req.KeepAlive() || !respWriter.KeepAlive() {
+			return
+		}
+
+		if !s.setConnState(conn, CONN_IDLE) {
+			// shutting down
+			return
+		}
 	}
+}
+
+// serveRequest calls the handler and finishes its response, recovering from
+// a panic in it so it only costs the current connection. It returns false if
+// the handler panicked or its response is incomplete, in which case the
+// connection must be closed.
+func (s *Server) serveRequest(w *response.Writer, req *request.Request, logger *slog.Logger) (ok bool) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Error("Panic serving request",
+				"method", req.RequestLine.Method,
+				"target", req.RequestLine.RequestTarget,
+				"panic", err,
+				"stack", string(debug.Stack()),
+			)
+			if w.State() == response.WriteStatusLine {
+				// nothing sent yet, we can still tell the client
+				handlerErr := &HandlerError{
+					StatusCode: response.StatusInternalServerError,
+					Message:    "Internal Server Error",
+				}
+				handlerErr.WriteErrorResponse(w)
+			}
+			ok = false
+		}
+	}()
+
+	s.handler(w, req)
 
-	s.handler(respWriter, req)
+	if err := w.Finish(); err != nil {
+		logger.Warn("Error finishing response", "error", err)
+		return false
+	}
+	return true
 }
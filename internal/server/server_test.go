@@ -0,0 +1,462 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/agustin-carnevale/tcp-to-http/internal/headers"
+	"github.com/agustin-carnevale/tcp-to-http/internal/request"
+	"github.com/agustin-carnevale/tcp-to-http/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeText(w *response.Writer, statusCode response.StatusCode, body string) {
+	w.WriteStatusLine(statusCode)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)), false)
+	w.WriteBody([]byte(body))
+}
+
+// startServer serves handler on a random port and returns the address to dial
+func startServer(t *testing.T, handler Handler, config Config) (*Server, string) {
+	t.Helper()
+	server, err := ServeWithConfig(0, handler, config)
+	require.NoError(t, err)
+	t.Cleanup(func() { server.Close() })
+	return server, server.Listener.Addr().String()
+}
+
+func TestServerKeepAlive(t *testing.T) {
+	_, addr := startServer(t, func(w *response.Writer, req *request.Request) {
+		writeText(w, response.StatusOK, req.RequestLine.RequestTarget)
+	}, Config{})
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Test: Pipelined requests answered in order on the same connection
+	_, err = io.WriteString(conn, "GET /first HTTP/1.1\r\nHost: localhost\r\n\r\nGET /second HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+
+	reader := bufio.NewReader(conn)
+	for _, target := range []string{"/first", "/second"} {
+		resp, err := http.ReadResponse(reader, nil)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, 200, resp.StatusCode)
+		assert.Equal(t, target, string(body))
+	}
+
+	// Test: Connection: close is honored
+	_, err = io.WriteString(conn, "GET /last HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	require.NoError(t, err)
+	resp, err := http.ReadResponse(reader, nil)
+	require.NoError(t, err)
+	_, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	_, err = reader.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestServerTimeouts(t *testing.T) {
+	_, addr := startServer(t, func(w *response.Writer, req *request.Request) {
+		writeText(w, response.StatusOK, "ok")
+	}, Config{ReadHeaderTimeout: 100 * time.Millisecond})
+
+	// Test: Headers not finished in time get a 408
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n")
+	require.NoError(t, err)
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 408, resp.StatusCode)
+}
+
+func TestServerBodyReadTimeout(t *testing.T) {
+	_, addr := startServer(t, func(w *response.Writer, req *request.Request) {
+		writeText(w, response.StatusOK, string(req.Body))
+	}, Config{ReadHeaderTimeout: 100 * time.Millisecond, ReadTimeout: 2 * time.Second})
+
+	// Test: A small body only has to arrive within ReadTimeout
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\n\r\n")
+	require.NoError(t, err)
+	time.Sleep(200 * time.Millisecond)
+	_, err = io.WriteString(conn, "hello")
+	require.NoError(t, err)
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "hello", string(body))
+}
+
+func TestServerShutdown(t *testing.T) {
+	release := make(chan struct{})
+	server, addr := startServer(t, func(w *response.Writer, req *request.Request) {
+		if req.RequestLine.RequestTarget == "/slow" {
+			<-release
+		}
+		writeText(w, response.StatusOK, "done")
+	}, Config{})
+
+	// an idle keep-alive connection
+	idleConn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer idleConn.Close()
+	_, err = io.WriteString(idleConn, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	idleReader := bufio.NewReader(idleConn)
+	resp, err := http.ReadResponse(idleReader, nil)
+	require.NoError(t, err)
+	io.ReadAll(resp.Body)
+
+	// a connection in the middle of a request
+	activeConn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer activeConn.Close()
+	_, err = io.WriteString(activeConn, "GET /slow HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+
+	// Test: In-flight request is drained, idle connection is closed
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		close(release)
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	cut, err := server.Shutdown(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, cut)
+
+	resp, err = http.ReadResponse(bufio.NewReader(activeConn), nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "done", string(body))
+
+	_, err = idleReader.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+
+	// Test: New connections are refused
+	_, err = net.Dial("tcp", addr)
+	assert.Error(t, err)
+}
+
+func TestServerShutdownTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	server, addr := startServer(t, func(w *response.Writer, req *request.Request) {
+		<-release
+	}, Config{})
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+
+	// Test: Handler still running when the deadline is hit
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	cut, err := server.Shutdown(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 1, cut)
+}
+
+func TestServerBadRequest(t *testing.T) {
+	_, addr := startServer(t, func(w *response.Writer, req *request.Request) {
+		writeText(w, response.StatusOK, "ok")
+	}, Config{})
+
+	tests := []struct {
+		data       string
+		statusCode int
+	}{
+		{"GET / HTTP/1.1\r\nHost localhost\r\n\r\n", 400},
+		{"SE(ND / HTTP/1.1\r\nHost: localhost\r\n\r\n", 400},
+		{"GET / HTTP/1.8\r\nHost: localhost\r\n\r\n", 505},
+		{"GET / HTTP/2.0\r\nHost: localhost\r\n\r\n", 505},
+		{"GET / FOO\r\nHost: localhost\r\n\r\n", 505},
+		// Host is mandatory, only once
+		{"GET / HTTP/1.1\r\n\r\n", 400},
+		{"GET / HTTP/1.1\r\nHost: localhost\r\nHost: example.com\r\n\r\n", 400},
+		{"GET / HTTP/1.1\r\nHost: local host\r\n\r\n", 400},
+		{"GET / HTTP/1.1\r\nHost: localhost\r\nX-Folded: a\r\n b\r\n\r\n", 400},
+		// the server is still up after all those
+		{"GET / HTTP/1.1\r\nHost: localhost\r\n\r\n", 200},
+	}
+	for _, tt := range tests {
+		conn, err := net.Dial("tcp", addr)
+		require.NoError(t, err)
+		_, err = io.WriteString(conn, tt.data)
+		require.NoError(t, err)
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		require.NoError(t, err)
+		assert.Equal(t, tt.statusCode, resp.StatusCode, tt.data)
+		conn.Close()
+	}
+}
+
+func TestServerPanicRecovery(t *testing.T) {
+	_, addr := startServer(t, func(w *response.Writer, req *request.Request) {
+		switch req.RequestLine.RequestTarget {
+		case "/panic":
+			panic("handler is broken")
+		case "/panic-later":
+			w.WriteStatusLine(response.StatusOK)
+			panic("handler is broken after the status line")
+		}
+		writeText(w, response.StatusOK, "ok")
+	}, Config{})
+
+	// Test: Panic before writing anything gets a 500
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "GET /panic HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 500, resp.StatusCode)
+	io.ReadAll(resp.Body)
+	_, err = reader.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+
+	// Test: Panic after the status line aborts the connection
+	conn, err = net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "GET /panic-later HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	data, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n", string(data))
+
+	// Test: The server is still up
+	conn, err = net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	resp, err = http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+}
+
+func TestServerLogger(t *testing.T) {
+	lines := make(lineWriter, 10)
+	logger := slog.New(slog.NewJSONHandler(lines, nil))
+	_, addr := startServer(t, func(w *response.Writer, req *request.Request) {
+		panic("broken")
+	}, Config{Logger: logger})
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "GET /broken HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+
+	// Test: Errors are logged with the connection and request ids
+	var record map[string]any
+	require.NoError(t, json.Unmarshal([]byte(<-lines), &record))
+	assert.Equal(t, "Panic serving request", record["msg"])
+	assert.Equal(t, "/broken", record["target"])
+	assert.Equal(t, conn.LocalAddr().String(), record["remote_addr"])
+	assert.NotEmpty(t, record["conn_id"])
+	assert.Equal(t, fmt.Sprintf("%v-1", record["conn_id"]), record["request_id"])
+}
+
+func TestServerExpectContinue(t *testing.T) {
+	_, addr := startServer(t, func(w *response.Writer, req *request.Request) {
+		if req.RequestLine.RequestTarget == "/ignore-body" {
+			writeText(w, response.StatusForbidden, "no thanks")
+			return
+		}
+		body, err := io.ReadAll(req.BodyReader)
+		if err != nil {
+			writeText(w, response.StatusBadRequest, err.Error())
+			return
+		}
+		writeText(w, response.StatusOK, string(body))
+	}, Config{})
+
+	// Test: 100 Continue is sent when the handler reads the body
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "POST /upload HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\nExpect: 100-continue\r\n\r\n")
+	require.NoError(t, err)
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 100, resp.StatusCode)
+
+	_, err = io.WriteString(conn, "hello")
+	require.NoError(t, err)
+	resp, err = http.ReadResponse(reader, nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "hello", string(body))
+
+	// Test: No 100 Continue if the handler answers without reading,
+	// and the connection is closed since the body may never come
+	conn, err = net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "POST /ignore-body HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\nExpect: 100-continue\r\n\r\n")
+	require.NoError(t, err)
+	reader = bufio.NewReader(conn)
+	resp, err = http.ReadResponse(reader, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 403, resp.StatusCode)
+	io.ReadAll(resp.Body)
+	_, err = reader.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+
+	// Test: Unknown expectation
+	conn, err = net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "POST /upload HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\nExpect: something-else\r\n\r\n")
+	require.NoError(t, err)
+	resp, err = http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 417, resp.StatusCode)
+}
+
+func TestServerResponseFraming(t *testing.T) {
+	_, addr := startServer(t, func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.StatusOK)
+		switch req.RequestLine.RequestTarget {
+		case "/small":
+			w.WriteHeaders(headers.NewHeaders(), false)
+			io.WriteString(w, "small body")
+		case "/large":
+			w.WriteHeaders(headers.NewHeaders(), false)
+			io.Copy(w, strings.NewReader(strings.Repeat("x", 3*response.DefaultBufferSize)))
+		case "/short":
+			h := headers.NewHeaders()
+			h.Set("Content-Length", "100")
+			w.WriteHeaders(h, false)
+			io.WriteString(w, "not 100 bytes")
+		}
+	}, Config{})
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	// Test: Length of a small body is set by the writer
+	_, err = io.WriteString(conn, "GET /small HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	resp, err := http.ReadResponse(reader, nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), resp.ContentLength)
+	assert.Equal(t, "small body", string(body))
+
+	// Test: Large body is chunked, connection still reusable
+	_, err = io.WriteString(conn, "GET /large HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	resp, err = http.ReadResponse(reader, nil)
+	require.NoError(t, err)
+	body, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"chunked"}, resp.TransferEncoding)
+	assert.Len(t, body, 3*response.DefaultBufferSize)
+
+	// Test: HEAD gets the headers without a body, connection still reusable
+	_, err = io.WriteString(conn, "HEAD /short HTTP/1.1\r\nHost: localhost\r\n\r\nHEAD /small HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	for _, length := range []int64{100, 10} {
+		resp, err = http.ReadResponse(reader, &http.Request{Method: "HEAD"})
+		require.NoError(t, err)
+		assert.Equal(t, 200, resp.StatusCode)
+		assert.Equal(t, length, resp.ContentLength)
+	}
+
+	// Test: Body shorter than its Content-Length, connection closed
+	_, err = io.WriteString(conn, "GET /short HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	resp, err = http.ReadResponse(reader, nil)
+	require.NoError(t, err)
+	_, err = io.ReadAll(resp.Body)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestServerHTTP10(t *testing.T) {
+	_, addr := startServer(t, func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(headers.NewHeaders(), false)
+		io.WriteString(w, strings.Repeat("x", 2*response.DefaultBufferSize))
+	}, Config{})
+
+	// Test: Response in HTTP/1.0, body ended by closing the connection
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "GET / HTTP/1.0\r\n\r\n")
+	require.NoError(t, err)
+	data, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.0 200 OK\r\n\r\n"+strings.Repeat("x", 2*response.DefaultBufferSize), string(data))
+}
+
+func TestServerAllowedMethods(t *testing.T) {
+	// Test: Any method reaches the handler by default
+	_, addr := startServer(t, func(w *response.Writer, req *request.Request) {
+		writeText(w, response.StatusOK, req.RequestLine.Method)
+	}, Config{})
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "PURGE /cache HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "PURGE", string(body))
+
+	// Test: Methods out of the allowlist are not implemented
+	_, addr = startServer(t, func(w *response.Writer, req *request.Request) {
+		writeText(w, response.StatusOK, req.RequestLine.Method)
+	}, Config{AllowedMethods: []string{"GET", "PROPFIND"}})
+	for method, statusCode := range map[string]int{"GET": 200, "PROPFIND": 200, "PURGE": 501, "get": 501} {
+		conn, err := net.Dial("tcp", addr)
+		require.NoError(t, err)
+		_, err = io.WriteString(conn, method+" / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+		require.NoError(t, err)
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		require.NoError(t, err)
+		assert.Equal(t, statusCode, resp.StatusCode, method)
+		conn.Close()
+	}
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// How often Shutdown checks if the active connections are done
+const shutdownPollInterval = 50 * time.Millisecond
+
+type connState int
+
+const (
+	// waiting for a (new) request, safe to close
+	CONN_IDLE connState = iota
+	// reading a request or writing its response
+	CONN_ACTIVE
+)
+
+// Shutdown gracefully stops the server: it stops accepting connections,
+// closes the idle ones and waits for the active ones to finish their
+// current response. If ctx is done before that, the remaining connections
+// are closed anyway. It returns how many connections were cut that way.
+func (s *Server) Shutdown(ctx context.Context) (int, error) {
+	s.closed.Store(true)
+	var err error
+	if s.Listener != nil {
+		err = s.Listener.Close()
+	}
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if s.closeIdleConns() == 0 {
+			return 0, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return s.closeAllConns(), ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// trackConn registers a new connection, it returns false
+// if the server is shutting down and the connection must not be served
+func (s *Server) trackConn(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed.Load() {
+		return false
+	}
+	if s.conns == nil {
+		s.conns = map[net.Conn]connState{}
+	}
+	s.conns[conn] = CONN_IDLE
+	return true
+}
+
+func (s *Server) untrackConn(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, conn)
+}
+
+// setConnState updates the state of a connection. It returns false if the
+// connection is not tracked anymore (closed by Shutdown) or if it became idle
+// while shutting down, in both cases the connection must be closed.
+func (s *Server) setConnState(conn net.Conn, state connState) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.conns[conn]; !exists {
+		return false
+	}
+	if state == CONN_IDLE && s.closed.Load() {
+		return false
+	}
+	s.conns[conn] = state
+	return true
+}
+
+// closeIdleConns closes the connections waiting for a request
+// and returns how many active connections are left
+func (s *Server) closeIdleConns() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for conn, state := range s.conns {
+		if state == CONN_IDLE {
+			conn.Close()
+			delete(s.conns, conn)
+		}
+	}
+	return len(s.conns)
+}
+
+// closeAllConns closes every connection left and returns how many were closed
+func (s *Server) closeAllConns() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	closed := len(s.conns)
+	for conn := range s.conns {
+		conn.Close()
+		delete(s.conns, conn)
+	}
+	return closed
+}
@@ -0,0 +1,119 @@
+package vhost
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/agustin-carnevale/tcp-to-http/internal/request"
+	"github.com/agustin-carnevale/tcp-to-http/internal/response"
+	"github.com/agustin-carnevale/tcp-to-http/internal/server"
+)
+
+// Mux dispatches requests to handlers registered by host name, so a single
+// server can serve several sites. A pattern is a host name, optionally with
+// a port, where the first label can be a wildcard:
+//   - example.com matches example.com on any port
+//   - example.com:8080 matches example.com:8080 only
+//   - *.example.com matches any subdomain of example.com (api.example.com,
+//     a.b.example.com), but not example.com itself
+//
+// Names are case-insensitive. Exact names win over wildcards, longer
+// wildcards over shorter ones, and patterns with a port over the ones
+// without. Requests matching no pattern go to Default, or get a 404.
+// Mux.Serve is a server.Handler.
+type Mux struct {
+	// handlers by normalized pattern (lowercase, port joined if any)
+	handlers map[string]server.Handler
+	// Default, if set, handles the requests matching no pattern
+	Default server.Handler
+}
+
+func New() *Mux {
+	return &Mux{
+		handlers: map[string]server.Handler{},
+	}
+}
+
+// Handle registers handler for requests to the hosts matching pattern.
+// It panics if the pattern is invalid or already registered.
+func (m *Mux) Handle(pattern string, handler server.Handler) {
+	host, port := splitHostPort(pattern)
+	name, wildcard := strings.CutPrefix(host, "*.")
+	if name == "" || strings.ContainsAny(name, "*/ ") || strings.HasPrefix(name, ".") {
+		panic(fmt.Sprintf("vhost: invalid pattern %q", pattern))
+	}
+	if wildcard {
+		name = "*." + name
+	}
+
+	key := hostKey(name, port)
+	if _, exists := m.handlers[key]; exists {
+		panic(fmt.Sprintf("vhost: pattern %q already registered", pattern))
+	}
+	m.handlers[key] = handler
+}
+
+// Serve dispatches the request to the handler of its host
+func (m *Mux) Serve(w *response.Writer, req *request.Request) {
+	if handler := m.match(req.Host()); handler != nil {
+		handler(w, req)
+		return
+	}
+
+	if m.Default != nil {
+		m.Default(w, req)
+		return
+	}
+	notFound := &server.HandlerError{StatusCode: response.StatusNotFound, Message: "Not Found", KeepAlive: true}
+	notFound.WriteErrorResponse(w)
+}
+
+// match returns the handler for host, or nil if no pattern matches it
+func (m *Mux) match(host string) server.Handler {
+	name, port := splitHostPort(host)
+	if name == "" {
+		return nil
+	}
+
+	// exact name first, then wildcards from the longest suffix
+	candidates := []string{name}
+	for rest := name; ; {
+		_, after, found := strings.Cut(rest, ".")
+		if !found || after == "" {
+			break
+		}
+		candidates = append(candidates, "*."+after)
+		rest = after
+	}
+
+	for _, candidate := range candidates {
+		if port != "" {
+			if handler, exists := m.handlers[hostKey(candidate, port)]; exists {
+				return handler
+			}
+		}
+		if handler, exists := m.handlers[candidate]; exists {
+			return handler
+		}
+	}
+	return nil
+}
+
+// splitHostPort splits a host[:port] in its lowercase name (without the
+// brackets of an IPv6 address or a trailing dot) and port
+func splitHostPort(hostport string) (string, string) {
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		// no port
+		host, port = strings.TrimSuffix(strings.TrimPrefix(hostport, "["), "]"), ""
+	}
+	return strings.TrimSuffix(strings.ToLower(host), "."), port
+}
+
+func hostKey(name, port string) string {
+	if port == "" {
+		return name
+	}
+	return net.JoinHostPort(name, port)
+}
@@ -0,0 +1,112 @@
+package vhost
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/agustin-carnevale/tcp-to-http/internal/request"
+	"github.com/agustin-carnevale/tcp-to-http/internal/response"
+	"github.com/agustin-carnevale/tcp-to-http/internal/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recorder gives handlers that record their name when they are called
+type recorder struct {
+	served string
+}
+
+func (r *recorder) handler(name string) server.Handler {
+	return func(w *response.Writer, req *request.Request) {
+		r.served = name
+	}
+}
+
+// route runs the mux on the given raw request
+// and returns the name of the handler it went to
+func (r *recorder) route(t *testing.T, m *Mux, rawRequest string) string {
+	t.Helper()
+	req, err := request.RequestFromReader(strings.NewReader(rawRequest))
+	require.NoError(t, err)
+	r.served = ""
+	m.Serve(nil, req)
+	return r.served
+}
+
+func TestMux(t *testing.T) {
+	rec := &recorder{}
+	m := New()
+	m.Handle("example.com", rec.handler("example"))
+	m.Handle("example.com:8080", rec.handler("example 8080"))
+	m.Handle("*.example.com", rec.handler("subdomain"))
+	m.Handle("*.api.example.com", rec.handler("api subdomain"))
+	m.Handle("Docs.Example.COM", rec.handler("docs"))
+	m.Handle("[::1]", rec.handler("ipv6"))
+
+	tests := []struct {
+		host    string
+		handler string
+	}{
+		{"example.com", "example"},
+		{"EXAMPLE.com.", "example"},
+		{"example.com:443", "example"},
+		// a port-specific pattern wins
+		{"example.com:8080", "example 8080"},
+		{"www.example.com", "subdomain"},
+		{"a.b.example.com:9000", "subdomain"},
+		// the longest wildcard wins, exact names win over wildcards
+		{"v1.api.example.com", "api subdomain"},
+		{"docs.example.com", "docs"},
+		{"[::1]:8080", "ipv6"},
+	}
+	for _, tt := range tests {
+		served := rec.route(t, m, "GET / HTTP/1.1\r\nHost: "+tt.host+"\r\n\r\n")
+		assert.Equal(t, tt.handler, served, tt.host)
+	}
+	assert.Nil(t, m.match("example.org"))
+	assert.Nil(t, m.match(""))
+
+	// Test: The authority of an absolute-form target wins over Host
+	served := rec.route(t, m, "GET http://www.example.com/ HTTP/1.1\r\nHost: example.org\r\n\r\n")
+	assert.Equal(t, "subdomain", served)
+
+	// Test: Default handler
+	m.Default = rec.handler("default")
+	served = rec.route(t, m, "GET / HTTP/1.1\r\nHost: example.org\r\n\r\n")
+	assert.Equal(t, "default", served)
+}
+
+func TestMuxNotFound(t *testing.T) {
+	req, err := request.RequestFromReader(strings.NewReader("GET / HTTP/1.1\r\nHost: example.org\r\n\r\n"))
+	require.NoError(t, err)
+
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	go func() {
+		defer serverConn.Close()
+		New().Serve(&response.Writer{Connection: serverConn}, req)
+	}()
+
+	resp, err := http.ReadResponse(bufio.NewReader(clientConn), nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, 404, resp.StatusCode)
+	assert.Equal(t, "Not Found", string(body))
+	// an unknown host doesn't cost the connection
+	assert.False(t, resp.Close)
+}
+
+func TestMuxInvalidPatterns(t *testing.T) {
+	m := New()
+	m.Handle("example.com", nil)
+	assert.Panics(t, func() { m.Handle("EXAMPLE.COM", nil) })
+	assert.Panics(t, func() { m.Handle("", nil) })
+	assert.Panics(t, func() { m.Handle("*.", nil) })
+	assert.Panics(t, func() { m.Handle("a.*.example.com", nil) })
+	assert.Panics(t, func() { m.Handle("example.com/path", nil) })
+}